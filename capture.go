@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// outputDrainTimeout is how long a stopped program's remaining output is read after it exits.
+const outputDrainTimeout = 5 * time.Second
+
+// attemptStop describes why runner stopped an attempt before the program exited on its own.
+type attemptStop int
+
+const (
+	stopNone    attemptStop = iota // the program exited on its own
+	stopTimeout                    // the program exceeded config.timeout
+	stopIdle                       // the program produced no output for config.idleTimeout
+)
+
+// attemptOutput is the output of a single attempt. stdout and stderr are only
+// captured separately if config.separateStreams is set.
+type attemptOutput struct {
+	combined string
+	stdout   string
+	stderr   string
+}
+
+// capturedBuffer retains output written to it, for retrieval via String.
+type capturedBuffer interface {
+	io.Writer
+	String() string
+}
+
+// newCapturedBuffer returns a buffer which retains at most maxBytes (if nonzero) of output.
+func newCapturedBuffer(maxBytes int) capturedBuffer {
+	if maxBytes > 0 {
+		return newHeadTailBuffer(maxBytes)
+	}
+	return &bytes.Buffer{}
+}
+
+// lockedWriter serializes writes to w from multiple goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// activityWriter writes to w, and signals activity (without blocking) after each write.
+type activityWriter struct {
+	w        io.Writer
+	activity chan<- struct{}
+}
+
+// bestEffortWriter writes to w, ignoring any errors, so that it can't interrupt
+// the capture of output by an io.MultiWriter.
+type bestEffortWriter struct {
+	w io.Writer
+}
+
+func (b bestEffortWriter) Write(p []byte) (int, error) {
+	_, _ = b.w.Write(p)
+	return len(p), nil
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	n, err := a.w.Write(p)
+	select {
+	case a.activity <- struct{}{}:
+	default:
+	}
+	return n, err
+}
+
+// runAttempt runs the given command once, capturing its combined stdout and stderr
+// (and, if config.separateStreams is set, each separately).
+// If config.maxOutputBytes is nonzero, only the beginning and end of the output are
+// captured (config.liveOutput still receives all of it). Output written to config.liveOutput
+// isn't redacted here; it must redact the output itself (see redactingWriter).
+// If config.timeout is nonzero and the program runs longer than that, or config.idleTimeout
+// is nonzero and the program produces no output for that long, the program is stopped
+// and stopped reports why. A stopped program (and its process group, where supported) is
+// sent config.gracefulSignal, then killed if it hasn't exited after config.killGrace.
+func runAttempt(cmd *exec.Cmd, config *runConfig) (output attemptOutput, stopped attemptStop, err error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return output, stopNone, err
+	}
+	defer pr.Close()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	var prErr, pwErr *os.File
+	if config.separateStreams {
+		prErr, pwErr, err = os.Pipe()
+		if err != nil {
+			_ = pw.Close()
+			return output, stopNone, err
+		}
+		defer prErr.Close()
+		cmd.Stderr = pwErr
+	}
+
+	err = startCommand(cmd, config)
+	_ = pw.Close()
+	if pwErr != nil {
+		_ = pwErr.Close()
+	}
+	if err != nil {
+		return output, stopNone, err
+	}
+	if config.nice != 0 {
+		// Set right after the program starts, so a child it forks immediately may not inherit this:
+		if err := setNiceness(cmd.Process.Pid, config.nice); err != nil {
+			config.outputConfig.addSetupWarningOnce(fmt.Sprintf("Failed to set the program's niceness to %d per -nice: %s", config.nice, err))
+		}
+	}
+	if config.ioPriorityClass != ioPriorityClassNone {
+		if err := setIOPriority(cmd.Process.Pid, config.ioPriorityClass, config.ioPriorityLevel); err != nil {
+			config.outputConfig.addSetupWarningOnce(fmt.Sprintf("Failed to set the program's I/O priority per -ionice-class/-ionice-level: %s", err))
+		}
+	}
+
+	// The buffers may only be read after copyDone is closed.
+	buf := newCapturedBuffer(config.maxOutputBytes)
+	stdoutBuf := newCapturedBuffer(config.maxOutputBytes)
+	stderrBuf := newCapturedBuffer(config.maxOutputBytes)
+	collectOutput := func() attemptOutput {
+		retv := attemptOutput{combined: buf.String()}
+		if config.separateStreams {
+			retv.stdout = stdoutBuf.String()
+			retv.stderr = stderrBuf.String()
+		}
+		return retv
+	}
+
+	dest := io.Writer(buf)
+	if config.liveOutput != nil {
+		dest = io.MultiWriter(buf, bestEffortWriter{config.liveOutput})
+	}
+	activity := make(chan struct{}, 1)
+	var copies sync.WaitGroup
+	copyStream := func(r io.Reader, w io.Writer) {
+		copies.Add(1)
+		go func() {
+			defer copies.Done()
+			_, _ = io.Copy(&activityWriter{w: w, activity: activity}, r)
+		}()
+	}
+	if config.separateStreams {
+		// the streams are still interleaved in the combined output, in the order they're read:
+		dest = &lockedWriter{w: dest}
+		copyStream(pr, io.MultiWriter(dest, stdoutBuf))
+		copyStream(prErr, io.MultiWriter(dest, stderrBuf))
+	} else {
+		copyStream(pr, dest)
+	}
+	copyDone := make(chan struct{})
+	go func() {
+		copies.Wait()
+		close(copyDone)
+	}()
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- cmd.Wait()
+	}()
+
+	var timeoutC <-chan time.Time
+	if config.timeout > 0 {
+		timeoutTimer := time.NewTimer(config.timeout)
+		defer timeoutTimer.Stop()
+		timeoutC = timeoutTimer.C
+	}
+	var idleTimer *time.Timer
+	var idleC <-chan time.Time
+	if config.idleTimeout > 0 {
+		idleTimer = time.NewTimer(config.idleTimeout)
+		defer idleTimer.Stop()
+		idleC = idleTimer.C
+	}
+
+waitLoop:
+	for {
+		select {
+		case err = <-waitDone:
+			<-copyDone
+			return collectOutput(), stopNone, err
+		case <-timeoutC:
+			stopped = stopTimeout
+			break waitLoop
+		case <-idleC:
+			stopped = stopIdle
+			break waitLoop
+		case <-activity:
+			if idleTimer != nil {
+				if !idleTimer.Stop() {
+					select {
+					case <-idleTimer.C:
+					default:
+					}
+				}
+				idleTimer.Reset(config.idleTimeout)
+			}
+		}
+	}
+
+	if config.killGrace > 0 {
+		// Ask the program to exit, giving it a chance to flush its output:
+		graceTimer := time.NewTimer(config.killGrace)
+		defer graceTimer.Stop()
+		if signalProcessGroup(cmd.Process, config.gracefulSignal) != nil {
+			killProcessGroup(cmd.Process)
+		}
+		select {
+		case err = <-waitDone:
+		case <-graceTimer.C:
+			killProcessGroup(cmd.Process)
+			err = <-waitDone
+		}
+	} else {
+		killProcessGroup(cmd.Process)
+		err = <-waitDone
+	}
+
+	// Read the program's remaining output, but not indefinitely: a descendant process
+	// which left the process group (e.g. via setsid) may still hold the output pipe(s) open.
+	drainTimer := time.NewTimer(outputDrainTimeout)
+	defer drainTimer.Stop()
+	select {
+	case <-copyDone:
+	case <-drainTimer.C:
+		_ = pr.Close()
+		if prErr != nil {
+			_ = prErr.Close()
+		}
+		<-copyDone
+	}
+	return collectOutput(), stopped, err
+}
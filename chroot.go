@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// lookPathInChroot searches for the given program in the directories named by env's PATH,
+// as they appear within the given chroot directory, returning its path within the chroot.
+// Programs given as a path (absolute or relative) are returned as-is.
+func lookPathInChroot(chroot, file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	path := ""
+	for _, v := range env {
+		if strings.HasPrefix(v, "PATH=") {
+			path = strings.TrimPrefix(v, "PATH=")
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		candidate := filepath.Join(dir, file)
+		info, err := os.Stat(filepath.Join(chroot, candidate))
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
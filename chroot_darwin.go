@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// setChroot runs the program with the given directory as its root directory.
+func setChroot(attr *syscall.SysProcAttr, dir string) {
+	attr.Chroot = dir
+}
+
+// canChroot returns false if runner definitely lacks the privileges to chroot.
+func canChroot() bool {
+	return os.Geteuid() == 0
+}
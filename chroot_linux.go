@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const capSysChroot = 18 // CAP_SYS_CHROOT, from linux/capability.h
+
+// setChroot runs the program with the given directory as its root directory.
+func setChroot(attr *syscall.SysProcAttr, dir string) {
+	attr.Chroot = dir
+}
+
+// canChroot returns false if runner definitely lacks the CAP_SYS_CHROOT capability.
+func canChroot() bool {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "CapEff:") {
+			caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+			return err != nil || caps&(1<<capSysChroot) != 0
+		}
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+package main
+
+import "syscall"
+
+func setChroot(_ *syscall.SysProcAttr, _ string) {
+	// no-op on Windows
+}
+
+func canChroot() bool {
+	return false
+}
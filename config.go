@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configFileFlags lists flags which may not be set from a config file.
+var configFileFlags = []string{"config", "version"}
+
+// applyConfigFile loads the TOML file at path, whose keys are flag names, and sets each
+// flag which wasn't given on the command line to the file's value. This must be called
+// after flag.Parse and before any flag's value is used; since values from the file are
+// set as if they were given as flags, they take precedence over environment variables.
+//
+// If the file can't be loaded, none of it is applied and err is non-nil. Problems with
+// individual keys don't prevent the rest of the file from being applied; they are
+// returned as optionErrs.
+func applyConfigFile(path string) (optionErrs []error, err error) {
+	var values map[string]interface{}
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return nil, err
+	}
+
+	givenOnCommandLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		givenOnCommandLine[f.Name] = true
+	})
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if flag.Lookup(key) == nil || stringSliceContains(configFileFlags, key) {
+			optionErrs = append(optionErrs, fmt.Errorf("unknown option '%s'", key))
+			continue
+		}
+		if givenOnCommandLine[key] {
+			continue
+		}
+
+		// arrays set repeatable flags (e.g. print-if-match) once per element:
+		elems, ok := values[key].([]interface{})
+		if !ok {
+			elems = []interface{}{values[key]}
+		}
+		for _, elem := range elems {
+			strVal, err := configValueString(elem)
+			if err == nil {
+				err = flag.Set(key, strVal)
+			}
+			if err != nil {
+				optionErrs = append(optionErrs, fmt.Errorf("invalid value for '%s': %w", key, err))
+			}
+		}
+	}
+	return optionErrs, nil
+}
+
+// configValueString converts a TOML value to the string form its flag expects.
+func configValueString(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", v)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	crashEmoj     = "💥"
+	crashExitCode = 2
+	statusCrashed = "Crashed"
+)
+
+// handlePanic must be deferred. If runner panics, it makes a best-effort attempt to
+// report the crash via the first configured delivery channel that works and to write
+// a crash log, then exits with a non-zero status.
+func handlePanic(deliveryCfg *deliveryConfig, logCfg *logConfig, hostname, jobName string, noEmoji bool) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	log.Printf("runner crashed: %v\n%s", r, stack)
+
+	now := time.Now()
+	crashOut := &runOutput{
+		output:      fmt.Sprintf("runner crashed while running %s: %v\n\n%s", jobName, r, stack),
+		header:      fmt.Sprintf("runner crashed while running %s\n\n", jobName),
+		summaryLine: fmt.Sprintf("[%s] runner crashed running %s", hostname, jobName),
+		emoj:        statusMarker(crashEmoj, noEmoji),
+		status:      statusCrashed,
+		jobName:     jobName,
+		hostname:    hostname,
+		exitCode:    -1,
+		startTime:   now,
+		endTime:     now,
+		shouldPrint: true,
+	}
+	logFileName := fmt.Sprintf("%s.%s.crash.log",
+		removeBadFilenameChars(jobName),
+		now.Format("2006-01-02T15-04-05.000-0700"),
+	)
+
+	var deliveryResults []deliveryResult
+	if deliveryCfg.mail != nil {
+		deliveryCfg.mail.logFileName = logFileName
+	}
+	if deliveryCfg.discord != nil {
+		deliveryCfg.discord.logFileName = logFileName
+	}
+	for _, channel := range deliveryCfg.channels() {
+		result := timeDelivery(channel, func() (detail string, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic during crash delivery: %v", r)
+				}
+			}()
+			return executeDelivery(deliveryCfg, channel, crashOut)
+		})
+		deliveryResults = append(deliveryResults, result)
+		if result.err == nil {
+			break
+		}
+	}
+
+	crashLogCfg := *logCfg
+	crashLogCfg.logFileName = logFileName
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Failed to write crash log: %v", r)
+			}
+		}()
+		if err := writeLogs(&crashLogCfg, crashOut, deliveryResults, deliveryErrors(deliveryResults)); err != nil {
+			log.Printf("Failed to write crash log: %s", err)
+		}
+	}()
+
+	os.Exit(crashExitCode)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dedupConfig, if provided, enables best-effort deduplication of alerts across hosts
+// which share dedupDir (e.g. via NFS).
+type dedupConfig struct {
+	dedupDir string
+	window   time.Duration
+	hostname string
+}
+
+const dedupFilePerm = 0664
+
+// claimAlert attempts to claim the right to deliver an alert for the given job.
+//
+// The first host to create the job's claim file (via O_EXCL) wins; other hosts
+// suppress their alerts until the claim is older than the configured window.
+// Two hosts may both deliver if they race to replace an expired claim, or if the
+// shared filesystem does not honor O_EXCL. If the dedup directory is unusable,
+// the alert is not suppressed and an error is returned.
+//
+// If the alert should be suppressed, claimAlert returns false and a description
+// of the claim that caused the suppression.
+func claimAlert(cfg *dedupConfig, jobName string) (bool, string, error) {
+	claimPath := filepath.Join(cfg.dedupDir, removeBadFilenameChars(jobName)+".dedup")
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(claimPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, dedupFilePerm)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%s\n%s\n", cfg.hostname, time.Now().Format(time.RFC3339))
+			closeErr := f.Close()
+			if err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return true, "", fmt.Errorf("failed to write dedup claim '%s': %w", claimPath, err)
+			}
+			return true, "", nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return true, "", fmt.Errorf("failed to create dedup claim '%s': %w", claimPath, err)
+		}
+
+		fi, err := os.Stat(claimPath)
+		if err != nil {
+			// the claim may have been removed by another host; try again
+			continue
+		}
+		if time.Since(fi.ModTime()) < cfg.window {
+			holder := "another host"
+			if content, err := os.ReadFile(claimPath); err == nil {
+				if h := strings.SplitN(string(content), "\n", 2)[0]; h != "" {
+					holder = h
+				}
+			}
+			return false, fmt.Sprintf("alert already claimed by %s at %s",
+				holder, fi.ModTime().Format("2006-01-02 15:04:05 -0700")), nil
+		}
+		if err := os.Remove(claimPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return true, "", fmt.Errorf("failed to remove expired dedup claim '%s': %w", claimPath, err)
+		}
+	}
+
+	return true, "", fmt.Errorf("failed to claim dedup file '%s' after removing an expired claim", claimPath)
+}
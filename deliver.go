@@ -2,34 +2,64 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/cdzombak/gotfy"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
 
+// deliveryConfig's transport must be non-nil; each channel's config may be nil.
 type deliveryConfig struct {
-	mail    *mailDeliveryConfig
-	ntfy    *ntfyDeliveryConfig
-	discord *discordDeliveryConfig
+	transport *transportConfig
+	mail      *mailDeliveryConfig
+	ntfy      *ntfyDeliveryConfig
+	discord   *discordDeliveryConfig
+	zulip     *zulipDeliveryConfig
+	whatsApp  *whatsAppDeliveryConfig
+	gotify    *gotifyDeliveryConfig
+	matrix    *matrixDeliveryConfig
+	pagerduty *pagerdutyDeliveryConfig
+	sns       *snsDeliveryConfig
+	webhook   *webhookDeliveryConfig
 }
 
 // mailDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
 type mailDeliveryConfig struct {
-	mailTo             string
+	mailTo             []string
+	mailCc             []string
+	mailBcc            []string
 	mailFrom           string
 	smtpUser           string
 	smtpPassword       string
-	smtpHost           string
+	smtpHosts          []string
 	smtpPort           int
+	smtpEncryption     string
 	tabCharReplacement string
+	attachJSON         bool
+	attachThreshold    int
+	attachGzip         bool
+	html               bool
+	logFileName        string
 }
 
 // ntfyDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
@@ -40,95 +70,496 @@ type ntfyDeliveryConfig struct {
 	ntfyEmail       string
 	ntfyAccessToken string
 	ntfyPriority    int
+	ntfyClickURL    *url.URL
+	ntfyActions     []gotfy.ActionButton
 }
 
 // discordDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+// If discordContent is nil, the message's content is the summary line.
 type discordDeliveryConfig struct {
 	discordWebhookURL string
+	discordContent    *template.Template
+	discordUsername   string
+	discordAvatarURL  string
 	logFileName       string
 }
 
+// zulipDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+type zulipDeliveryConfig struct {
+	zulipSiteURL string
+	zulipEmail   string
+	zulipAPIKey  string
+	zulipStream  string
+	zulipTopic   string
+}
+
+// whatsAppDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+// whatsAppToken may be empty if the gateway doesn't require authentication.
+type whatsAppDeliveryConfig struct {
+	whatsAppGatewayURL string
+	whatsAppToken      string
+	whatsAppTo         string
+}
+
+// gotifyDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+// If gotifyPriority is negative, the message's priority is derived from the run's status.
+type gotifyDeliveryConfig struct {
+	gotifyServerURL string
+	gotifyToken     string
+	gotifyPriority  int
+}
+
+// matrixDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+type matrixDeliveryConfig struct {
+	matrixHomeserverURL string
+	matrixToken         string
+	matrixRoomID        string
+}
+
+// pagerdutyDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+// If pagerdutyAutoResolve is set, successful runs resolve the job's open incident.
+type pagerdutyDeliveryConfig struct {
+	pagerdutyRoutingKey  string
+	pagerdutyAutoResolve bool
+}
+
+// snsDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+// If snsRegion is empty, the AWS SDK's default region configuration is used.
+type snsDeliveryConfig struct {
+	snsTopicARN string
+	snsRegion   string
+}
+
+// webhookDeliveryConfig, if provided, is assumed to be complete, valid, and internally consistent.
+type webhookDeliveryConfig struct {
+	webhookURL     string
+	webhookHeaders http.Header
+}
+
+// deliveryResult records the outcome of a single delivery channel.
+// If skipReason is non-empty, the delivery was not attempted.
+// detail optionally provides more information about a (successful) delivery.
+type deliveryResult struct {
+	channel    string
+	duration   time.Duration
+	err        error
+	skipReason string
+	detail     string
+}
+
+const (
+	channelMail      = "mail"
+	channelNtfy      = "ntfy"
+	channelDiscord   = "discord"
+	channelZulip     = "zulip"
+	channelWhatsApp  = "whatsapp"
+	channelGotify    = "gotify"
+	channelMatrix    = "matrix"
+	channelPagerDuty = "pagerduty"
+	channelSNS       = "sns"
+	channelWebhook   = "webhook"
+)
+
+// -notify-on modes, which control which runs' output is delivered:
+const (
+	notifyOnFailure = "failure" // runs whose output is printed (the default)
+	notifyOnSuccess = "success" // successful runs
+	notifyOnAlways  = "always"  // every run
+	notifyOnChange  = "change"  // runs whose status differs from the previous run's
+)
+
 const (
 	successNotifyTimeout = 10 * time.Second
 	ntfyTimeout          = 10 * time.Second
 	discordTimeout       = 10 * time.Second
 	mailTimeout          = 10 * time.Second
+	zulipTimeout         = 10 * time.Second
+	whatsAppTimeout      = 10 * time.Second
+	gotifyTimeout        = 10 * time.Second
+	matrixTimeout        = 10 * time.Second
+	pagerdutyTimeout     = 10 * time.Second
+	snsTimeout           = 10 * time.Second
+	webhookTimeout       = 10 * time.Second
+)
+
+// defaultMailAttachmentName names the output attached to emails when there's no log file name.
+const defaultMailAttachmentName = "output.log"
+
+// discordMaxContentLength is the longest message content Discord accepts.
+const discordMaxContentLength = 2000
+
+// zulipMaxContentLength is the longest message Zulip accepts by default.
+const zulipMaxContentLength = 10000
+
+// whatsAppMaxMessageLength is the longest text message WhatsApp accepts.
+const whatsAppMaxMessageLength = 4096
+
+// matrixMaxOutputLength limits the output included in Matrix messages. Matrix events are
+// limited to 64 KiB, and the output appears in both the plain and (HTML-escaped, so up to
+// 5x longer) formatted bodies.
+const matrixMaxOutputLength = 10000
+
+// pagerdutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerdutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty limits event summaries to 1,024 characters, and events to 512 KB.
+const (
+	pagerdutyMaxSummaryLength = 1024
+	pagerdutyMaxOutputLength  = 256 * 1024
+)
+
+// SNS limits messages to 256 KB, and subjects to 100 printable ASCII characters.
+const (
+	snsMaxMessageLength = 256 * 1024
+	snsMaxSubjectLength = 100
 )
 
-func executeDeliveries(config *deliveryConfig, runOutput *runOutput) []error {
-	var deliveryErrors []error
-	if config.mail != nil {
-		deliveryErrors = extendErrSlice(deliveryErrors,
-			executeMailDelivery(config.mail, runOutput))
+// Gotify message priorities (on Gotify's 0-10 scale) used when -gotify-priority isn't given:
+const (
+	gotifyFailurePriority = 8
+	gotifyPartialPriority = 5
+	gotifySuccessPriority = 2
+)
+
+// executeDeliveries delivers the given output via each configured channel, except those
+// listed in skip (which maps channel names to the reason they are skipped).
+func executeDeliveries(config *deliveryConfig, runOutput *runOutput, skip map[string]string) []deliveryResult {
+	var results []deliveryResult
+	for _, channel := range config.channels() {
+		channel := channel
+		if reason, ok := skip[channel]; ok {
+			results = append(results, deliveryResult{channel: channel, skipReason: reason})
+			continue
+		}
+		results = append(results, timeDelivery(channel, func() (string, error) {
+			return executeDelivery(config, channel, runOutput)
+		}))
 	}
-	if config.ntfy != nil {
-		deliveryErrors = extendErrSlice(deliveryErrors,
-			executeNtfyDelivery(config.ntfy, runOutput))
+	return results
+}
+
+// executeDelivery delivers the given output via a single configured channel.
+// It returns an optional detail message about the delivery.
+func executeDelivery(config *deliveryConfig, channel string, runOutput *runOutput) (string, error) {
+	switch channel {
+	case channelMail:
+		return executeMailDelivery(config.mail, config.transport, runOutput)
+	case channelNtfy:
+		return "", executeNtfyDelivery(config.ntfy, config.transport, runOutput)
+	case channelDiscord:
+		return "", executeDiscordDelivery(config.discord, config.transport, runOutput)
+	case channelZulip:
+		return "", executeZulipDelivery(config.zulip, config.transport, runOutput)
+	case channelWhatsApp:
+		return "", executeWhatsAppDelivery(config.whatsApp, config.transport, runOutput)
+	case channelGotify:
+		return "", executeGotifyDelivery(config.gotify, config.transport, runOutput)
+	case channelMatrix:
+		return "", executeMatrixDelivery(config.matrix, config.transport, runOutput)
+	case channelPagerDuty:
+		return executePagerdutyDelivery(config.pagerduty, config.transport, runOutput)
+	case channelSNS:
+		return "", executeSNSDelivery(config.sns, config.transport, runOutput)
+	case channelWebhook:
+		return "", executeWebhookDelivery(config.webhook, config.transport, runOutput)
 	}
-	if config.discord != nil {
-		deliveryErrors = extendErrSlice(deliveryErrors,
-			executeDiscordDelivery(config.discord, runOutput))
+	return "", fmt.Errorf("unknown delivery channel '%s'", channel)
+}
+
+// skipDeliveries returns a skipped result, with the given reason, for each configured channel.
+func skipDeliveries(config *deliveryConfig, reason string) []deliveryResult {
+	var results []deliveryResult
+	for _, channel := range config.channels() {
+		results = append(results, deliveryResult{channel: channel, skipReason: reason})
 	}
-	return deliveryErrors
+	return results
 }
 
-func executeMailDelivery(cfg *mailDeliveryConfig, runOutput *runOutput) error {
-	server := mail.NewSMTPClient()
-	server.Host = cfg.smtpHost
-	server.Port = cfg.smtpPort
-	server.Username = cfg.smtpUser
-	server.Password = cfg.smtpPassword
-	server.KeepAlive = false
-	server.ConnectTimeout = mailTimeout
-	server.SendTimeout = mailTimeout
+// allChannels returns the names of all supported delivery channels.
+func allChannels() []string {
+	return []string{channelMail, channelNtfy, channelDiscord, channelZulip, channelWhatsApp, channelGotify, channelMatrix, channelPagerDuty, channelSNS, channelWebhook}
+}
 
-	smtpClient, err := server.Connect()
-	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+// channels returns the names of all configured delivery channels.
+func (c *deliveryConfig) channels() []string {
+	var retv []string
+	if c.mail != nil {
+		retv = append(retv, channelMail)
+	}
+	if c.ntfy != nil {
+		retv = append(retv, channelNtfy)
+	}
+	if c.discord != nil {
+		retv = append(retv, channelDiscord)
+	}
+	if c.zulip != nil {
+		retv = append(retv, channelZulip)
+	}
+	if c.whatsApp != nil {
+		retv = append(retv, channelWhatsApp)
+	}
+	if c.gotify != nil {
+		retv = append(retv, channelGotify)
+	}
+	if c.matrix != nil {
+		retv = append(retv, channelMatrix)
+	}
+	if c.pagerduty != nil {
+		retv = append(retv, channelPagerDuty)
+	}
+	if c.sns != nil {
+		retv = append(retv, channelSNS)
+	}
+	if c.webhook != nil {
+		retv = append(retv, channelWebhook)
+	}
+	return retv
+}
+
+func timeDelivery(channel string, deliver func() (string, error)) deliveryResult {
+	start := time.Now()
+	detail, err := deliver()
+	return deliveryResult{
+		channel:  channel,
+		duration: time.Since(start),
+		err:      err,
+		detail:   detail,
+	}
+}
+
+func deliveryErrors(results []deliveryResult) []error {
+	var errs []error
+	for _, r := range results {
+		errs = extendErrSlice(errs, r.err)
+	}
+	return errs
+}
+
+// executeMailDelivery sends the email via the first of cfg.smtpHosts which accepts a connection.
+// It returns a detail message naming the SMTP server used.
+func executeMailDelivery(cfg *mailDeliveryConfig, transport *transportConfig, runOutput *runOutput) (string, error) {
+	var smtpClient *mail.SMTPClient
+	var smtpHost string
+	var connectErrs []string
+	for _, host := range cfg.smtpHosts {
+		server := mail.NewSMTPClient()
+		server.Host = host
+		server.Port = cfg.smtpPort
+		server.Username = cfg.smtpUser
+		server.Password = cfg.smtpPassword
+		server.KeepAlive = false
+		server.ConnectTimeout = transport.timeoutOr(mailTimeout)
+		server.SendTimeout = transport.timeoutOr(mailTimeout)
+		server.Encryption = smtpEncryptionFor(cfg.smtpEncryption, cfg.smtpPort)
+		server.TLSConfig = transport.smtpTLSConfig(host)
+
+		c, err := server.Connect()
+		if err != nil {
+			connectErrs = append(connectErrs, fmt.Sprintf("%s: %s", host, err))
+			continue
+		}
+		smtpClient = c
+		smtpHost = host
+		break
+	}
+	if smtpClient == nil {
+		return "", fmt.Errorf("failed to connect to SMTP server (%s)", strings.Join(connectErrs, "; "))
+	}
+	detail := "via " + smtpHost
+	if len(connectErrs) > 0 {
+		detail = fmt.Sprintf("via %s, after failing to connect to %s", smtpHost, strings.Join(connectErrs, "; "))
 	}
 
 	email := mail.NewMSG()
 	email.SetFrom(cfg.mailFrom)
-	email.AddTo(cfg.mailTo)
+	email.AddTo(cfg.mailTo...)
+	if len(cfg.mailCc) > 0 {
+		email.AddCc(cfg.mailCc...)
+	}
+	if len(cfg.mailBcc) > 0 {
+		email.AddBcc(cfg.mailBcc...)
+	}
 	email.SetSubject(fmt.Sprintf("%s %s", runOutput.emoj, runOutput.summaryLine))
 	email.AddHeader("X-Mailer", productIdentifier())
-	body := strings.ReplaceAll(runOutput.output, "\n", "\r\n")
-	if cfg.tabCharReplacement != "" {
-		body = strings.ReplaceAll(body, "\t", cfg.tabCharReplacement)
+	bodyText := runOutput.output
+	body := mailBody(cfg, bodyText)
+	if cfg.attachThreshold > 0 && len(body) > cfg.attachThreshold {
+		// attach the output instead of inlining it, so the message isn't rejected for its size:
+		attachment, err := mailOutputAttachment(cfg, runOutput)
+		if err != nil {
+			return "", err
+		}
+		email.Attach(attachment)
+		bodyText = fmt.Sprintf("%s%s(output is %d bytes; see the attached %s)\n",
+			runOutput.header, programOutputHeading, len(runOutput.output), attachment.Name)
+		body = mailBody(cfg, bodyText)
 	}
 	email.SetBody(mail.TextPlain, body)
+	if cfg.html {
+		email.AddAlternative(mail.TextHTML, mailHTMLBody(cfg, runOutput, bodyText))
+	}
+	if traceName, traceContent, ok := attachableTraceFile(runOutput); ok {
+		email.Attach(&mail.File{
+			Name:     traceName,
+			MimeType: "text/plain",
+			Data:     traceContent,
+		})
+	}
+	if cfg.attachJSON {
+		resultJSON, err := json.MarshalIndent(runOutput.result(), "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to build result.json attachment: %w", err)
+		}
+		email.Attach(&mail.File{
+			Name:     "result.json",
+			MimeType: "application/json",
+			Data:     resultJSON,
+		})
+	}
 	if email.Error != nil {
-		return fmt.Errorf("failed to build email: %w", email.Error)
+		return "", fmt.Errorf("failed to build email: %w", email.Error)
 	}
 
-	if err = email.Send(smtpClient); err != nil {
-		return fmt.Errorf("failed to send email to %s: %w", cfg.mailTo, err)
+	if err := email.Send(smtpClient); err != nil {
+		return "", fmt.Errorf("failed to send email to %s via %s: %w", strings.Join(cfg.mailTo, ", "), smtpHost, err)
 	}
-	return nil
+	return detail, nil
+}
+
+// splitMailAddresses splits a comma-separated list of email addresses. Addresses which
+// don't contain an "@" are returned separately, as invalid.
+func splitMailAddresses(list string) (valid, invalid []string) {
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, "@") {
+			invalid = append(invalid, addr)
+			continue
+		}
+		valid = append(valid, addr)
+	}
+	return valid, invalid
+}
+
+const (
+	smtpEncryptionAuto     = "auto"
+	smtpEncryptionNone     = "none"
+	smtpEncryptionSSL      = "ssl"
+	smtpEncryptionSTARTTLS = "starttls"
+)
+
+// smtpEncryptionFor returns the mail library's encryption setting for the given -smtp-encryption mode.
+// The "auto" mode infers encryption from the port: SSL/TLS for 465, STARTTLS for 587, and none otherwise.
+func smtpEncryptionFor(mode string, port int) mail.Encryption {
+	switch mode {
+	case smtpEncryptionNone:
+		return mail.EncryptionNone
+	case smtpEncryptionSSL:
+		return mail.EncryptionSSLTLS
+	case smtpEncryptionSTARTTLS:
+		return mail.EncryptionSTARTTLS
+	}
+	switch port {
+	case 465:
+		return mail.EncryptionSSLTLS
+	case 587:
+		return mail.EncryptionSTARTTLS
+	}
+	return mail.EncryptionNone
+}
+
+// mailBody converts the given text to an email body, per cfg.
+func mailBody(cfg *mailDeliveryConfig, text string) string {
+	body := strings.ReplaceAll(text, "\n", "\r\n")
+	if cfg.tabCharReplacement != "" {
+		body = strings.ReplaceAll(body, "\t", cfg.tabCharReplacement)
+	}
+	return body
+}
+
+// mailHTMLBody returns an HTML version of the given email body text, with the run's summary
+// line as a header colored by the run's status, and the text in a monospace block.
+func mailHTMLBody(cfg *mailDeliveryConfig, runOutput *runOutput, text string) string {
+	color := "#c0392b"
+	if runOutput.partial {
+		color = "#d68910"
+	} else if runOutput.succeeded {
+		color = "#1e8449"
+	}
+	return fmt.Sprintf("<!DOCTYPE html>\r\n<html><body>\r\n"+
+		"<h2 style=\"color: %s; font-family: sans-serif;\">%s</h2>\r\n"+
+		"<pre style=\"font-family: Menlo, Consolas, monospace; font-size: 12px; white-space: pre-wrap;\">%s</pre>\r\n"+
+		"</body></html>\r\n",
+		color,
+		html.EscapeString(runOutput.emoj+" "+runOutput.summaryLine),
+		html.EscapeString(mailBody(cfg, text)),
+	)
+}
+
+// mailOutputAttachment returns the run's full output as an email attachment, gzipped if cfg.attachGzip is set.
+// The attachment is named like the run's log file, if cfg.logFileName is set.
+func mailOutputAttachment(cfg *mailDeliveryConfig, runOutput *runOutput) (*mail.File, error) {
+	name := cfg.logFileName
+	if name == "" {
+		name = defaultMailAttachmentName
+	}
+	if !cfg.attachGzip {
+		return &mail.File{
+			Name:     name,
+			MimeType: "text/plain",
+			Data:     []byte(runOutput.output),
+		}, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(runOutput.output)); err != nil {
+		return nil, fmt.Errorf("failed to gzip output for email attachment: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip output for email attachment: %w", err)
+	}
+	return &mail.File{
+		Name:     name + ".gz",
+		MimeType: "application/gzip",
+		Data:     buf.Bytes(),
+	}, nil
 }
 
-func executeNtfyDelivery(cfg *ntfyDeliveryConfig, runOutput *runOutput) error {
+func executeNtfyDelivery(cfg *ntfyDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
 	var ntfyAuth gotfy.Authorization
 	if cfg.ntfyAccessToken != "" {
 		ntfyAuth = gotfy.AccessToken(cfg.ntfyAccessToken)
 	}
+	ntfyHeaders := http.Header{
+		"User-Agent": {productIdentifier()},
+	}
+	if cfg.ntfyClickURL != nil {
+		// sent as a header, since gotfy.Message doesn't marshal its ClickURL correctly:
+		ntfyHeaders.Set("X-Click", cfg.ntfyClickURL.String())
+	}
 	ntfyPublisher := gotfy.NewPublisher(gotfy.PublisherOpts{
-		Server: cfg.ntfyServerURL,
-		Auth:   ntfyAuth,
-		Headers: http.Header{
-			"User-Agent": {productIdentifier()},
-		},
+		Server:     cfg.ntfyServerURL,
+		Auth:       ntfyAuth,
+		Headers:    ntfyHeaders,
+		HttpClient: transport.httpClientWithHeaders(ntfyTimeout),
 	})
 
-	ctx, cancel := context.WithTimeout(context.Background(), ntfyTimeout)
+	priority := cfg.ntfyPriority
+	if runOutput.priority != 0 {
+		priority = runOutput.priority
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transport.timeoutOr(ntfyTimeout))
 	defer cancel()
 	_, err := ntfyPublisher.Send(ctx, gotfy.Message{
 		Topic:    cfg.ntfyTopic,
 		Tags:     strings.Split(cfg.ntfyTags, ","),
-		Priority: gotfy.Priority(cfg.ntfyPriority),
+		Priority: gotfy.Priority(priority),
 		Email:    cfg.ntfyEmail,
 		Title:    runOutput.summaryLine,
 		Message:  runOutput.output,
+		Actions:  cfg.ntfyActions,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to send ntfy notification: %w", err)
@@ -136,10 +567,36 @@ func executeNtfyDelivery(cfg *ntfyDeliveryConfig, runOutput *runOutput) error {
 	return nil
 }
 
-func executeDiscordDelivery(cfg *discordDeliveryConfig, runOutput *runOutput) error {
+func executeDiscordDelivery(cfg *discordDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
 	webhookBody := &bytes.Buffer{}
 	writer := multipart.NewWriter(webhookBody)
-	err := writer.WriteField("content", fmt.Sprintf("%s %s", runOutput.emoj, runOutput.summaryLine))
+	content := fmt.Sprintf("%s %s", runOutput.emoj, runOutput.summaryLine)
+	if cfg.discordContent != nil {
+		contentBuilder := strings.Builder{}
+		if err := cfg.discordContent.Execute(&contentBuilder, newNotificationTemplateData(runOutput)); err != nil {
+			return fmt.Errorf("failed executing -discord-content template: %w", err)
+		}
+		content = truncateString(contentBuilder.String(), discordMaxContentLength)
+	}
+	message := map[string]interface{}{"content": content}
+	if cfg.discordUsername != "" {
+		message["username"] = cfg.discordUsername
+	}
+	if cfg.discordAvatarURL != "" {
+		message["avatar_url"] = cfg.discordAvatarURL
+	}
+	if runOutput.priority != 0 {
+		// include a colored embed reflecting the priority mapped to the exit code:
+		message["embeds"] = []map[string]interface{}{{
+			"description": fmt.Sprintf("Exit code %d (priority %d)", runOutput.exitCode, runOutput.priority),
+			"color":       priorityColor(runOutput.priority),
+		}}
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed building Discord webhook body (json.Marshal): %w", err)
+	}
+	err = writer.WriteField("payload_json", string(payload))
 	if err != nil {
 		return fmt.Errorf("failed building Discord webhook body (.WriteField): %w", err)
 	}
@@ -151,13 +608,22 @@ func executeDiscordDelivery(cfg *discordDeliveryConfig, runOutput *runOutput) er
 	if err != nil {
 		return fmt.Errorf("failed attaching log file to Discord webhook body: %w", err)
 	}
+	if traceName, traceContent, ok := attachableTraceFile(runOutput); ok {
+		tracePart, err := writer.CreateFormFile("files[1]", traceName)
+		if err != nil {
+			return fmt.Errorf("failed building Discord webhook body (.CreateFormFile): %w", err)
+		}
+		_, err = tracePart.Write(traceContent)
+		if err != nil {
+			return fmt.Errorf("failed attaching trace file to Discord webhook body: %w", err)
+		}
+	}
 	err = writer.Close()
 	if err != nil {
 		return fmt.Errorf("failed building Discord webhook body (.Close): %w", err)
 	}
 
-	client := http.DefaultClient
-	client.Timeout = discordTimeout
+	client := transport.httpClientWithHeaders(discordTimeout)
 
 	req, err := http.NewRequest(http.MethodPost, cfg.discordWebhookURL, webhookBody)
 	if err != nil {
@@ -181,9 +647,371 @@ func executeDiscordDelivery(cfg *discordDeliveryConfig, runOutput *runOutput) er
 	return nil
 }
 
-func deliverSuccessNotification(url string) error {
-	client := http.DefaultClient
-	client.Timeout = successNotifyTimeout
+func executeZulipDelivery(cfg *zulipDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	heading := fmt.Sprintf("%s **%s**\n", runOutput.emoj, runOutput.summaryLine)
+	const fenceStart, fenceEnd = "```text\n", "\n```"
+	output := truncateOutputStart(runOutput.output, zulipMaxContentLength-len(heading)-len(fenceStart)-len(fenceEnd))
+	form := url.Values{}
+	form.Set("type", "stream")
+	form.Set("to", cfg.zulipStream)
+	form.Set("topic", cfg.zulipTopic)
+	form.Set("content", heading+fenceStart+output+fenceEnd)
+
+	apiURL := strings.TrimSuffix(cfg.zulipSiteURL, "/") + "/api/v1/messages"
+	req, err := http.NewRequest(http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed building Zulip HTTP request: %w", err)
+	}
+	req.SetBasicAuth(cfg.zulipEmail, cfg.zulipAPIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", productIdentifier())
+
+	resp, err := transport.httpClient(zulipTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed POSTing Zulip message: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed POSTing Zulip message (%s) and reading response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("failed POSTing Zulip message (%s): %s", resp.Status, respContent)
+	}
+	return nil
+}
+
+func executeWhatsAppDelivery(cfg *whatsAppDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	heading := fmt.Sprintf("%s %s\n\n", runOutput.emoj, runOutput.summaryLine)
+	payload, err := json.Marshal(map[string]string{
+		"to":      cfg.whatsAppTo,
+		"message": heading + truncateOutputStart(runOutput.output, whatsAppMaxMessageLength-len(heading)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed building WhatsApp gateway request body: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.whatsAppGatewayURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed building WhatsApp gateway HTTP request: %w", err)
+	}
+	if cfg.whatsAppToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.whatsAppToken)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", productIdentifier())
+
+	resp, err := transport.httpClient(whatsAppTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed POSTing to WhatsApp gateway: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed POSTing to WhatsApp gateway (%s) and reading response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("failed POSTing to WhatsApp gateway (%s): %s", resp.Status, respContent)
+	}
+	return nil
+}
+
+func executeGotifyDelivery(cfg *gotifyDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	priority := cfg.gotifyPriority
+	if priority < 0 {
+		switch {
+		case runOutput.partial:
+			priority = gotifyPartialPriority
+		case runOutput.succeeded:
+			priority = gotifySuccessPriority
+		default:
+			priority = gotifyFailurePriority
+		}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"title":    fmt.Sprintf("%s %s", runOutput.emoj, runOutput.summaryLine),
+		"message":  runOutput.output,
+		"priority": priority,
+	})
+	if err != nil {
+		return fmt.Errorf("failed building Gotify request body: %w", err)
+	}
+
+	apiURL := strings.TrimSuffix(cfg.gotifyServerURL, "/") + "/message?token=" + url.QueryEscape(cfg.gotifyToken)
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed building Gotify HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", productIdentifier())
+
+	resp, err := transport.httpClient(gotifyTimeout).Do(req)
+	if err != nil {
+		// the URL includes the token, so don't include it in the error:
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed POSTing Gotify message: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed POSTing Gotify message (%s) and reading response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("failed POSTing Gotify message (%s): %s", resp.Status, respContent)
+	}
+	return nil
+}
+
+func executeMatrixDelivery(cfg *matrixDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	heading := fmt.Sprintf("%s %s", runOutput.emoj, runOutput.summaryLine)
+	output := truncateOutputStart(runOutput.output, matrixMaxOutputLength)
+	payload, err := json.Marshal(map[string]string{
+		"msgtype":        "m.notice",
+		"body":           heading + "\n\n" + output,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": fmt.Sprintf("<p><strong>%s</strong></p><pre><code>%s</code></pre>", html.EscapeString(heading), html.EscapeString(output)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed building Matrix request body: %w", err)
+	}
+
+	// Matrix deduplicates messages by transaction ID, so each message needs a unique one:
+	txnIDBytes := make([]byte, 16)
+	if _, err := rand.Read(txnIDBytes); err != nil {
+		return fmt.Errorf("failed generating Matrix transaction ID: %w", err)
+	}
+	apiURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(cfg.matrixHomeserverURL, "/"), url.PathEscape(cfg.matrixRoomID), hex.EncodeToString(txnIDBytes))
+	req, err := http.NewRequest(http.MethodPut, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed building Matrix HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.matrixToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", productIdentifier())
+
+	resp, err := transport.httpClient(matrixTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed sending Matrix message: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed sending Matrix message (%s) and reading response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("failed sending Matrix message (%s): %s", resp.Status, respContent)
+	}
+	return nil
+}
+
+// executePagerdutyDelivery triggers a PagerDuty incident for a failed or partially successful
+// run. Other runs don't trigger incidents; the returned detail message notes why.
+func executePagerdutyDelivery(cfg *pagerdutyDeliveryConfig, transport *transportConfig, runOutput *runOutput) (string, error) {
+	severity := "error"
+	switch {
+	case runOutput.status == statusStarted:
+		return "start notifications don't trigger incidents", nil
+	case runOutput.status == statusTest:
+		severity = "info"
+	case runOutput.partial:
+		severity = "warning"
+	case runOutput.succeeded:
+		return "successful runs don't trigger incidents", nil
+	}
+	if runOutput.priority != 0 {
+		// a priority mapped by -priority-for-exit overrides the default severity:
+		severity = pagerdutySeverity(runOutput.priority)
+	}
+
+	summary := runOutput.summaryLine
+	if len(summary) > pagerdutyMaxSummaryLength {
+		summary = truncateString(summary, pagerdutyMaxSummaryLength-len("…"))
+	}
+	return "", sendPagerdutyEvent(cfg, transport, map[string]interface{}{
+		"event_action": "trigger",
+		"dedup_key":    pagerdutyDedupKey(runOutput),
+		"client":       productIdentifier(),
+		"payload": map[string]interface{}{
+			"summary":   summary,
+			"source":    runOutput.hostname,
+			"severity":  severity,
+			"timestamp": runOutput.endTime.Format(time.RFC3339),
+			"custom_details": map[string]interface{}{
+				"status":    runOutput.status,
+				"exit_code": runOutput.exitCode,
+				"output":    truncateOutputStart(runOutput.output, pagerdutyMaxOutputLength),
+			},
+		},
+	})
+}
+
+// resolvePagerdutyIncident resolves the job's open PagerDuty incident, if any, per
+// -pagerduty-auto-resolve. PagerDuty ignores resolve events for which no incident is open.
+func resolvePagerdutyIncident(cfg *pagerdutyDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	return sendPagerdutyEvent(cfg, transport, map[string]interface{}{
+		"event_action": "resolve",
+		"dedup_key":    pagerdutyDedupKey(runOutput),
+	})
+}
+
+// pagerdutyDedupKey identifies the job's incidents, so that repeated failures are grouped
+// into one incident and a later success can resolve it.
+func pagerdutyDedupKey(runOutput *runOutput) string {
+	return fmt.Sprintf("runner/%s/%s", runOutput.hostname, runOutput.jobName)
+}
+
+func sendPagerdutyEvent(cfg *pagerdutyDeliveryConfig, transport *transportConfig, event map[string]interface{}) error {
+	event["routing_key"] = cfg.pagerdutyRoutingKey
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed building PagerDuty request body: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, pagerdutyEventsURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed building PagerDuty HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", productIdentifier())
+
+	resp, err := transport.httpClient(pagerdutyTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed POSTing PagerDuty event: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed POSTing PagerDuty event (%s) and reading response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("failed POSTing PagerDuty event (%s): %s", resp.Status, respContent)
+	}
+	return nil
+}
+
+// executeSNSDelivery publishes the output to an Amazon SNS topic, using the AWS SDK's
+// default credential chain (environment, shared config files, or instance/task role).
+func executeSNSDelivery(cfg *snsDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	ctx, cancel := context.WithTimeout(context.Background(), transport.timeoutOr(snsTimeout))
+	defer cancel()
+
+	// the SDK's own client is used (rather than transport.httpClient) so that it can apply
+	// AWS_CA_BUNDLE:
+	httpClient := awshttp.NewBuildableClient().
+		WithTimeout(transport.timeoutOr(snsTimeout)).
+		WithTransportOptions(func(tr *http.Transport) {
+			if transport.tlsConfig != nil {
+				tr.TLSClientConfig = transport.tlsConfig.Clone()
+			}
+		})
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithHTTPClient(httpClient),
+	}
+	if cfg.snsRegion != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.snsRegion))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	_, err = sns.NewFromConfig(awsCfg).Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(cfg.snsTopicARN),
+		Subject:  aws.String(snsSubject(runOutput.summaryLine)),
+		Message:  aws.String(truncateOutputStart(runOutput.output, snsMaxMessageLength)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to SNS topic %s: %w", cfg.snsTopicARN, err)
+	}
+	return nil
+}
+
+// snsSubject converts the summary line to a valid SNS subject, which must be printable ASCII.
+func snsSubject(summaryLine string) string {
+	subject := strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, summaryLine)
+	if len(subject) > snsMaxSubjectLength {
+		subject = subject[:snsMaxSubjectLength-3] + "..."
+	}
+	return subject
+}
+
+// webhookPayload is the JSON body POSTed by the generic webhook channel.
+// Like runResult, which it extends, it is a stable, documented format.
+type webhookPayload struct {
+	runResult
+	SummaryLine string `json:"summary_line"`
+	Output      string `json:"output"`
+}
+
+func executeWebhookDelivery(cfg *webhookDeliveryConfig, transport *transportConfig, runOutput *runOutput) error {
+	payload, err := json.Marshal(webhookPayload{
+		runResult:   runOutput.result(),
+		SummaryLine: runOutput.summaryLine,
+		Output:      runOutput.output,
+	})
+	if err != nil {
+		return fmt.Errorf("failed building webhook request body: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed building webhook HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", productIdentifier())
+	for name, values := range cfg.webhookHeaders {
+		req.Header[name] = values
+	}
+
+	resp, err := transport.httpClientWithHeaders(webhookTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed POSTing to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed POSTing to webhook (%s) and reading response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("failed POSTing to webhook (%s): %s", resp.Status, respContent)
+	}
+	return nil
+}
+
+// truncateOutputStart shortens output to at most maxLen bytes by removing its beginning,
+// since the end of a failed program's output is usually the most informative part.
+func truncateOutputStart(output string, maxLen int) string {
+	const truncatedNote = "(output truncated)\n"
+	if len(output) <= maxLen {
+		return output
+	}
+	cut := len(output) - (maxLen - len(truncatedNote))
+	for cut < len(output) && !utf8.RuneStart(output[cut]) {
+		cut++
+	}
+	return truncatedNote + output[cut:]
+}
+
+// statusURL substitutes the run's exit code and (escaped) status for the {exit_code}
+// and {status} placeholders in the given -success-url or -failure-url.
+func statusURL(urlTemplate string, runOutput *runOutput) string {
+	return strings.NewReplacer(
+		"{exit_code}", strconv.Itoa(runOutput.exitCode),
+		"{status}", url.PathEscape(runOutput.status),
+	).Replace(urlTemplate)
+}
+
+func deliverStatusNotification(url string, transport *transportConfig) error {
+	client := transport.httpClient(successNotifyTimeout)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to build GET request for '%s': %w", url, err)
@@ -194,7 +1022,7 @@ func deliverSuccessNotification(url string) error {
 		return fmt.Errorf("failed to GET '%s': %w", url, err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode > 200 || resp.StatusCode < 299 {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		return fmt.Errorf("failed to GET '%s' (%s)", url, resp.Status)
 	}
 	return nil
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// recordDuration appends a successful run's duration to the job's recent durations,
+// keeping at most window entries.
+func (s *jobState) recordDuration(d time.Duration, window int) {
+	s.RecentDurationsMs = append(s.RecentDurationsMs, d.Milliseconds())
+	if len(s.RecentDurationsMs) > window {
+		s.RecentDurationsMs = s.RecentDurationsMs[len(s.RecentDurationsMs)-window:]
+	}
+}
+
+// recentDurations returns up to window of the job's most recently recorded durations.
+func (s *jobState) recentDurations(window int) []time.Duration {
+	samples := s.RecentDurationsMs
+	if len(samples) > window {
+		samples = samples[len(samples)-window:]
+	}
+	retv := make([]time.Duration, len(samples))
+	for i, ms := range samples {
+		retv[i] = time.Duration(ms) * time.Millisecond
+	}
+	return retv
+}
+
+// durationComparison describes how d compares to the average of the given recent durations,
+// e.g. "avg 18s over last 10 runs, +28%". It returns an empty string if there are no recent durations.
+func durationComparison(d time.Duration, recent []time.Duration) string {
+	if len(recent) == 0 {
+		return ""
+	}
+	var total time.Duration
+	for _, r := range recent {
+		total += r
+	}
+	avg := total / time.Duration(len(recent))
+	runs := "runs"
+	if len(recent) == 1 {
+		runs = "run"
+	}
+	retv := fmt.Sprintf("avg %s over last %d %s", roundDuration(avg), len(recent), runs)
+	if avg > 0 {
+		retv += fmt.Sprintf(", %+.0f%%", (float64(d)-float64(avg))/float64(avg)*100)
+	}
+	return retv
+}
+
+// roundDuration rounds d to a precision suitable for display alongside other durations.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second)
+	case d >= time.Second:
+		return d.Round(100 * time.Millisecond)
+	default:
+		return d.Round(time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// envDiff describes how the child environment differs from the parent environment.
+// Each returned line is prefixed with "+" (added), "-" (removed), or "~" (changed).
+// Hidden variables (see shouldHideEnvVar) are omitted, and censored variables' values are masked.
+func envDiff(parent, child, shownEnvVars []string) []string {
+	parentVars := envMap(parent)
+	childVars := envMap(child)
+
+	var names []string
+	for k := range parentVars {
+		names = append(names, k)
+	}
+	for k := range childVars {
+		if _, ok := parentVars[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var retv []string
+	for _, name := range names {
+		if shouldHideEnvVar(name, shownEnvVars) {
+			continue
+		}
+		parentVal, inParent := parentVars[name]
+		childVal, inChild := childVars[name]
+		switch {
+		case !inParent:
+			retv = append(retv, fmt.Sprintf("+ %s=%s", name, censoredEnvVarValue(name, childVal)))
+		case !inChild:
+			retv = append(retv, fmt.Sprintf("- %s=%s", name, censoredEnvVarValue(name, parentVal)))
+		case parentVal != childVal:
+			retv = append(retv, fmt.Sprintf("~ %s=%s (was: %s)", name,
+				censoredEnvVarValue(name, childVal), censoredEnvVarValue(name, parentVal)))
+		}
+	}
+	return retv
+}
+
+func envMap(env []string) map[string]string {
+	retv := make(map[string]string, len(env))
+	for _, v := range env {
+		pair := strings.SplitN(v, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		retv[pair[0]] = pair[1]
+	}
+	return retv
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 const (
 	minLenForCensorHint = 5
+
+	// minLenForRedaction is the shortest censored value outputRedactor will replace;
+	// replacing shorter values would mangle unrelated output.
+	minLenForRedaction  = 4
+	redactedPlaceholder = "[REDACTED]"
 )
 
 func hiddenEnvVars() []string {
@@ -18,10 +26,20 @@ func censoredEnvVars() []string {
 	retv := strings.Split(os.Getenv(CensorEnvVarsEnvVar), ":")
 	retv = append(retv, SMTPPassEnvVar)
 	retv = append(retv, NtfyAccessTokenEnvVar)
+	retv = append(retv, ZulipAPIKeyEnvVar)
+	retv = append(retv, WhatsAppTokenEnvVar)
+	retv = append(retv, GotifyTokenEnvVar)
+	retv = append(retv, MatrixTokenEnvVar)
+	retv = append(retv, PagerDutyRoutingKeyEnvVar)
 	return retv
 }
 
-func shouldHideEnvVar(varName string) bool {
+// shouldHideEnvVar returns true if the given variable should be omitted from output: if it's
+// listed in RUNNER_HIDE_ENV, or if shownEnvVars is non-empty and doesn't include it.
+func shouldHideEnvVar(varName string, shownEnvVars []string) bool {
+	if len(shownEnvVars) > 0 && !stringSliceContains(shownEnvVars, varName) {
+		return true
+	}
 	return stringSliceContains(hiddenEnvVars(), varName)
 }
 
@@ -35,6 +53,120 @@ func censoredEnvVarValue(varName, value string) string {
 	return fmt.Sprintf("%c[%d chars]%c", value[0], len(value)-2, value[len(value)-1])
 }
 
+// outputRedactor returns a replacer which replaces the values, in the given environment, of all
+// censored environment variables with a placeholder, so secrets echoed by the program don't
+// leak into its output.
+func outputRedactor(env []string) *strings.Replacer {
+	var oldnew []string
+	for _, value := range censoredValues(env) {
+		oldnew = append(oldnew, value, redactedPlaceholder)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// censoredValues returns the values, in the given environment, of all censored environment
+// variables which are long enough to be redacted from output.
+func censoredValues(env []string) []string {
+	envVars := envMap(env)
+	var retv []string
+	for _, varName := range censoredEnvVars() {
+		if value := envVars[varName]; len(value) >= minLenForRedaction {
+			retv = append(retv, value)
+		}
+	}
+	return retv
+}
+
+// redactingWriter redacts the given censored values from everything written to w, for
+// output which is written as the program runs (e.g. -live-log). Output which might be the
+// beginning of a censored value is held back until more is written, or until Flush is called.
+type redactingWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	secrets  []string
+	redactor *strings.Replacer
+	pending  []byte
+}
+
+func newRedactingWriter(w io.Writer, secrets []string) *redactingWriter {
+	var oldnew []string
+	for _, s := range secrets {
+		oldnew = append(oldnew, s, redactedPlaceholder)
+	}
+	return &redactingWriter{w: w, secrets: secrets, redactor: strings.NewReplacer(oldnew...)}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, p...)
+	cut := r.safeCut()
+	if cut == 0 {
+		return len(p), nil
+	}
+	_, err := io.WriteString(r.w, r.redactor.Replace(string(r.pending[:cut])))
+	r.pending = append(r.pending[:0], r.pending[cut:]...)
+	return len(p), err
+}
+
+// Flush redacts and writes any output which is being held back.
+func (r *redactingWriter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, r.redactor.Replace(string(r.pending)))
+	r.pending = r.pending[:0]
+	return err
+}
+
+// safeCut returns how much of the pending output can be redacted and written now: output
+// which can't be part of a censored value continuing into later writes, and which doesn't
+// split a censored value.
+func (r *redactingWriter) safeCut() int {
+	longest := 0
+	newlineInSecret := false
+	for _, s := range r.secrets {
+		if len(s) > longest {
+			longest = len(s)
+		}
+		newlineInSecret = newlineInSecret || strings.Contains(s, "\n")
+	}
+	if longest == 0 {
+		return len(r.pending)
+	}
+	cut := len(r.pending) - (longest - 1)
+	if !newlineInSecret {
+		// no censored value continues past the end of a line:
+		if i := bytes.LastIndexByte(r.pending, '\n'); i+1 > cut {
+			cut = i + 1
+		}
+	}
+	if cut <= 0 {
+		return 0
+	}
+	// move the cut back to the start of any censored value it would split:
+	for moved := true; moved; {
+		moved = false
+		for _, s := range r.secrets {
+			for start := 0; ; {
+				i := bytes.Index(r.pending[start:], []byte(s))
+				if i < 0 || start+i >= cut {
+					break
+				}
+				if start+i+len(s) > cut {
+					cut = start + i
+					moved = true
+					break
+				}
+				start += i + 1
+			}
+		}
+	}
+	return cut
+}
+
 func stringSliceContains(slice []string, value string) bool {
 	for _, v := range slice {
 		if v == value {
@@ -43,3 +175,12 @@ func stringSliceContains(slice []string, value string) bool {
 	}
 	return false
 }
+
+func intSliceContains(slice []int, value int) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
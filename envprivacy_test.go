@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactingWriterRedactsValuesSplitAcrossWrites(t *testing.T) {
+	var out strings.Builder
+	w := newRedactingWriter(&out, []string{"hunter22"})
+	for _, chunk := range []string{"password: hun", "ter", "22 ok\nnext hunter", "22"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "password: [REDACTED] ok\nnext [REDACTED]"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestRedactingWriterWritesCompleteLinesImmediately(t *testing.T) {
+	var out strings.Builder
+	w := newRedactingWriter(&out, []string{"hunter22"})
+	_, _ = w.Write([]byte("line one\nline t"))
+	if want := "line one\n"; out.String() != want {
+		t.Errorf("output before Flush = %q, want %q", out.String(), want)
+	}
+}
+
+func TestRedactTraceFileRedactsCensoredValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.txt")
+	trace := "execve(\"/bin/job\", [\"job\"], [\"RUNNER_SMTP_PASS=hunter22\"]) = 0\nwrite(1, \"hunter22\", 8) = 8\n"
+	if err := os.WriteFile(path, []byte(trace), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := redactTraceFile(path, &runConfig{}, []string{SMTPPassEnvVar + "=hunter22"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "hunter22") {
+		t.Errorf("trace still contains censored value: %q", content)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// exitReason returns a human-readable explanation of the process's exit status,
+// or an empty string if the exit code speaks for itself.
+func exitReason(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	return fmt.Sprintf("killed by signal %d: %s", status.Signal(), status.Signal())
+}
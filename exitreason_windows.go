@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// windowsExitCodes describes common NTSTATUS values which are reported as a process's exit code
+// when it crashes or is terminated abnormally.
+var windowsExitCodes = map[uint32]string{
+	0x40010004: "DBG_TERMINATE_PROCESS: terminated by a debugger",
+	0xC0000005: "STATUS_ACCESS_VIOLATION: access violation",
+	0xC000001D: "STATUS_ILLEGAL_INSTRUCTION: illegal instruction",
+	0xC0000094: "STATUS_INTEGER_DIVIDE_BY_ZERO: integer division by zero",
+	0xC00000FD: "STATUS_STACK_OVERFLOW: stack overflow",
+	0xC0000135: "STATUS_DLL_NOT_FOUND: a required DLL was not found",
+	0xC0000139: "STATUS_ENTRYPOINT_NOT_FOUND: a required DLL entry point was not found",
+	0xC0000142: "STATUS_DLL_INIT_FAILED: DLL initialization failed",
+	0xC000013A: "STATUS_CONTROL_C_EXIT: terminated by Ctrl+C",
+	0xC0000409: "STATUS_STACK_BUFFER_OVERRUN: stack buffer overrun",
+	0xC0000417: "STATUS_INVALID_CRUNTIME_PARAMETER: invalid C runtime parameter",
+	0xC0000374: "STATUS_HEAP_CORRUPTION: heap corruption",
+}
+
+// exitReason returns a human-readable explanation of the process's exit status,
+// or an empty string if the exit code speaks for itself.
+func exitReason(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	code := uint32(state.ExitCode())
+	if desc, ok := windowsExitCodes[code]; ok {
+		return fmt.Sprintf("0x%08X %s", code, desc)
+	}
+	if code >= 0xC0000000 {
+		// error-severity NTSTATUS values are more recognizable in hex:
+		return fmt.Sprintf("0x%08X", code)
+	}
+	return ""
+}
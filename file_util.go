@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 func removeBadFilenameChars(filename string) string {
@@ -11,3 +16,63 @@ func removeBadFilenameChars(filename string) string {
 	}
 	return filename
 }
+
+// readSecretFile returns the first line of the given file, without its line ending.
+// This allows secrets to be given without exposing them in the process list.
+func readSecretFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// touchFile creates the given file if it doesn't exist, and sets its modification time to now.
+// If uid or gid isn't -1, the file's ownership is set accordingly.
+func touchFile(path string, uid, gid int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return err
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("failed to chown '%s' (%d, %d): %w", path, uid, gid, err)
+		}
+	}
+	return nil
+}
+
+// mkdirAllOwned is like os.MkdirAll, but also chowns each directory it creates
+// to the given UID and GID (unless both are -1).
+func mkdirAllOwned(dir string, perm os.FileMode, uid, gid int) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAllOwned(parent, perm, uid, gid); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, perm); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create directory '%s': %w", dir, err)
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return fmt.Errorf("failed to chown directory '%s' (%d, %d): %w", dir, uid, gid, err)
+		}
+	}
+	return nil
+}
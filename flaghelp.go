@@ -2,7 +2,7 @@ package main
 
 import "flag"
 
-// WasFlagGiven returns true if the flag was given on the command line.
+// WasFlagGiven returns true if the flag was given on the command line (or in the config file).
 func WasFlagGiven(flagName string) bool {
 	retv := false
 	flag.Visit(func(f *flag.Flag) {
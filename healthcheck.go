@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const healthcheckTimeout = 10 * time.Second
+
+// healthcheckMaxBodyLength is the most output healthchecks.io stores with a ping.
+const healthcheckMaxBodyLength = 100_000
+
+// pingHealthcheck pings the given healthchecks.io check URL, with the given suffix
+// (e.g. "/start" or "/fail"). If body is non-empty, it is POSTed with the ping.
+func pingHealthcheck(checkURL, suffix, body string, transport *transportConfig) error {
+	url := strings.TrimSuffix(checkURL, "/") + suffix
+	method := http.MethodGet
+	var bodyReader io.Reader
+	if body != "" {
+		method = http.MethodPost
+		bodyReader = strings.NewReader(truncateOutputStart(body, healthcheckMaxBodyLength))
+	}
+
+	req, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to build %s request for '%s': %w", method, url, err)
+	}
+	req.Header.Set("User-Agent", productIdentifier())
+	if body != "" {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	resp, err := transport.httpClient(healthcheckTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ping healthcheck '%s': %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to ping healthcheck '%s' (%s)", url, resp.Status)
+	}
+	return nil
+}
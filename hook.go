@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+const hookOutputHeading = "\n--- Hook Output ---\n\n"
+
+// runHook runs the given -on-success or -on-failure shell command after the program. It
+// returns a section, for the run's output, containing the hook's exit status and output.
+// The hook's exit status doesn't affect the run's status.
+func runHook(config *runConfig, childEnv []string, flagName, command string) string {
+	status, out, _ := runShellCommand(config, childEnv, command)
+	section := fmt.Sprintf("%s-%s hook (%s) %s.\n", hookOutputHeading, flagName, command, status)
+	if out != "" {
+		section += "\n" + out
+	}
+	return section
+}
+
+// runShellCommand runs the given shell command as the same user, and in the same working
+// directory and environment, as the program. It returns a description of the command's exit
+// status, its output, and whether it exited with status 0.
+func runShellCommand(config *runConfig, childEnv []string, command string) (string, string, bool) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	cmd.SysProcAttr = buildSysProcAttr(config)
+	cmd.Dir = config.workDir
+	cmd.Env = childEnv
+
+	shellCfg := *config
+	shellCfg.idleTimeout = 0
+	shellCfg.liveOutput = nil
+	shellCfg.separateStreams = false
+	shellOut, stopped, err := runAttempt(cmd, &shellCfg)
+
+	var status string
+	var exitError *exec.ExitError
+	switch {
+	case stopped == stopTimeout:
+		status = fmt.Sprintf("timed out after %s", config.timeout)
+	case err == nil:
+		status = "exited with status 0"
+	case errors.As(err, &exitError):
+		status = fmt.Sprintf("exited with status %d", exitError.ExitCode())
+	default:
+		status = fmt.Sprintf("failed to run: %s", err)
+	}
+	return status, shellOut.combined, stopped != stopTimeout && err == nil
+}
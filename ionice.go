@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// I/O scheduling classes, as used by Linux's ioprio_set(2):
+const (
+	ioPriorityClassNone       = 0
+	ioPriorityClassRealtime   = 1
+	ioPriorityClassBestEffort = 2
+	ioPriorityClassIdle       = 3
+)
+
+// defaultIOPriorityLevel is the level used for the realtime and best-effort classes if
+// -ionice-level isn't given, matching ionice(1).
+const defaultIOPriorityLevel = 4
+
+// parseIOPriorityClass parses an -ionice-class value, which may be given by name or by
+// number as with ionice(1).
+func parseIOPriorityClass(s string) (int, error) {
+	switch s {
+	case "realtime", "1":
+		return ioPriorityClassRealtime, nil
+	case "best-effort", "2":
+		return ioPriorityClassBestEffort, nil
+	case "idle", "3":
+		return ioPriorityClassIdle, nil
+	}
+	return ioPriorityClassNone, fmt.Errorf("'%s' is not one of realtime, best-effort, or idle", s)
+}
@@ -0,0 +1,6 @@
+package main
+
+func setIOPriority(_, _, _ int) error {
+	// no-op; I/O scheduling priority is only supported on Linux
+	return nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import "syscall"
+
+const (
+	ioPriorityWhoProcess = 1 // IOPRIO_WHO_PROCESS
+	ioPriorityClassShift = 13
+)
+
+// setIOPriority sets the I/O scheduling class and level of the given process.
+func setIOPriority(pid, class, level int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioPriorityWhoProcess, uintptr(pid), uintptr(class<<ioPriorityClassShift|level))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is how often acquireLock retries a held lock while waiting for it.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockFilePath returns the path of the -single-instance lock file for the given job.
+func lockFilePath(stateDir, jobName string) string {
+	return filepath.Join(stateDir, removeBadFilenameChars(jobName)+".lock")
+}
+
+// acquireLock takes an exclusive lock on the file at path, creating it (and its directory)
+// if necessary. If the lock is held by another process, acquireLock waits up to wait for it
+// to be released; if it isn't, acquireLock returns a nil file and a nil error.
+//
+// The lock is held until the returned file is closed or runner exits, however it exits.
+func acquireLock(path string, wait time.Duration) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock file directory '%s': %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file '%s': %w", path, err)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+		}
+		if locked {
+			return f, nil
+		}
+		if !time.Now().Before(deadline) {
+			_ = f.Close()
+			return nil, nil
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
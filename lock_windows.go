@@ -0,0 +1,10 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func tryLockFile(_ *os.File) (bool, error) {
+	return false, errors.New("file locking is not supported on Windows")
+}
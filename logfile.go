@@ -1,18 +1,29 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"time"
 )
 
+// If logRoot is non-empty, logDir must resolve (after following symlinks) to a path within it.
 type logConfig struct {
-	logDir      string
-	logFileName string
-	runAsUID    int
-	runAsGID    int
+	logDir                string
+	logRoot               string
+	logFileName           string
+	runAsUID              int
+	runAsGID              int
+	includeDeliveryStatus bool
+	jsonHeader            bool
+	omitProgramOutput     bool
+	format                string
+	keepDays              int
+	keepCount             int
 }
 
 const (
@@ -20,28 +31,149 @@ const (
 	defaultLogFilePerm = 0660
 )
 
-func writeLogs(cfg *logConfig, runOut *runOutput, deliveryErrs []error) error {
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// jsonLog is the content of a log file written with -log-format json.
+// Like runResult, which it extends, it is a stable, documented format.
+type jsonLog struct {
+	runResult
+	Output         string            `json:"output,omitempty"`
+	Stdout         string            `json:"stdout,omitempty"`
+	Stderr         string            `json:"stderr,omitempty"`
+	SetupWarnings  []string          `json:"setup_warnings"`
+	Deliveries     []jsonLogDelivery `json:"deliveries"`
+	DeliveryErrors []string          `json:"delivery_errors"`
+}
+
+type jsonLogDelivery struct {
+	Channel    string `json:"channel"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// defaultLogDir returns the XDG state directory for runner's logs. If the program runs as another
+// user whose home directory is known, the directory within that user's home is used.
+func defaultLogDir(runAsUser *runAsUserConfig) (string, error) {
+	if runAsUser != nil && runAsUser.userHome != "" {
+		return filepath.Join(runAsUser.userHome, ".local", "state", "runner"), nil
+	}
+	// per the XDG Base Directory spec, relative paths are invalid and must be ignored:
+	if stateHome := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(stateHome) {
+		return filepath.Join(stateHome, "runner"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "runner"), nil
+}
+
+// logNameData is the data available to a -log-name-template.
+type logNameData struct {
+	JobName   string
+	Hostname  string
+	StartTime time.Time
+	Status    string
+	ExitCode  int
+}
+
+// logFileNameFromTemplate executes the given -log-name-template for the run. The job name and
+// hostname are sanitized, but the template may include path separators to place the log file
+// in a subdirectory of the log directory. It may not place the log file outside the log directory.
+func logFileNameFromTemplate(tmpl *template.Template, runOut *runOutput) (string, error) {
+	name := strings.Builder{}
+	err := tmpl.Execute(&name, logNameData{
+		JobName:   removeBadFilenameChars(runOut.jobName),
+		Hostname:  removeBadFilenameChars(runOut.hostname),
+		StartTime: runOut.startTime,
+		Status:    runOut.status,
+		ExitCode:  runOut.exitCode,
+	})
+	if err != nil {
+		return "", err
+	}
+	retv := filepath.Clean(filepath.FromSlash(name.String()))
+	if retv == "." || filepath.IsAbs(retv) || retv == ".." || strings.HasPrefix(retv, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is not a file name within the log directory", name.String())
+	}
+	return retv, nil
+}
+
+func writeLogs(cfg *logConfig, runOut *runOutput, deliveryResults []deliveryResult, deliveryErrs []error) error {
 	if cfg.logDir == "" {
 		return nil
 	}
 
-	if _, err := os.Stat(cfg.logDir); os.IsNotExist(err) {
-		err = os.MkdirAll(cfg.logDir, defaultLogDirPerm)
+	logDir, err := prepareLogDir(cfg)
+	if err != nil {
+		return err
+	}
+	logFile := filepath.Join(logDir, cfg.logFileName)
+	if err := mkdirAllOwned(filepath.Dir(logFile), defaultLogDirPerm, cfg.runAsUID, cfg.runAsGID); err != nil {
+		return err
+	}
+
+	var logContent string
+	if cfg.format == logFormatJSON {
+		logContent, err = jsonLogContent(cfg, runOut, deliveryResults, deliveryErrs)
+	} else {
+		logContent, err = textLogContent(cfg, runOut, deliveryResults, deliveryErrs)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeLogFile(logFile, logContent)
+	if err != nil {
+		return fmt.Errorf("failed to write log file '%s': %w", logFile, err)
+	}
+
+	if cfg.runAsUID != -1 || cfg.runAsGID != -1 {
+		err = os.Chown(logFile, cfg.runAsUID, cfg.runAsGID)
 		if err != nil {
-			return fmt.Errorf("failed to create log directory '%s': %w", cfg.logDir, err)
-		}
-		if cfg.runAsUID != -1 || cfg.runAsGID != -1 {
-			err = os.Chown(cfg.logDir, cfg.runAsUID, cfg.runAsGID)
-			if err != nil {
-				return fmt.Errorf("failed to chown log directory '%s' (%d, %d): %w", cfg.logDir, cfg.runAsUID, cfg.runAsGID, err)
-			}
+			return fmt.Errorf("failed to chown log file '%s' (%d, %d): %w", logFile, cfg.runAsUID, cfg.runAsGID, err)
 		}
 	}
 
-	logFile := filepath.Join(cfg.logDir, cfg.logFileName)
+	return nil
+}
 
+func textLogContent(cfg *logConfig, runOut *runOutput, deliveryResults []deliveryResult, deliveryErrs []error) (string, error) {
 	logContent := strings.Builder{}
-	logContent.WriteString(runOut.output)
+	if cfg.jsonHeader {
+		header, err := json.Marshal(runOut.result())
+		if err != nil {
+			return "", fmt.Errorf("failed to build log JSON header: %w", err)
+		}
+		logContent.Write(header)
+		logContent.WriteRune('\n')
+	}
+	if cfg.omitProgramOutput {
+		logContent.WriteString(runOut.header)
+		logContent.WriteString(programOutputHeading)
+		logContent.WriteString("(omitted from log by -log-omit-output)\n")
+	} else {
+		logContent.WriteString(runOut.output)
+	}
+	if len(deliveryResults) > 0 && (cfg.includeDeliveryStatus || anyDeliveryNotable(deliveryResults)) {
+		logContent.WriteString("\n--- Delivery Status ---\n\n")
+		for _, r := range deliveryResults {
+			switch {
+			case r.skipReason != "":
+				logContent.WriteString(fmt.Sprintf("%s: skipped (%s)\n", r.channel, r.skipReason))
+			case r.err != nil:
+				logContent.WriteString(fmt.Sprintf("%s: failed (%s)\n", r.channel, r.duration.Round(time.Millisecond)))
+			case r.detail != "":
+				logContent.WriteString(fmt.Sprintf("%s: ok (%s; %s)\n", r.channel, r.duration.Round(time.Millisecond), r.detail))
+			default:
+				logContent.WriteString(fmt.Sprintf("%s: ok (%s)\n", r.channel, r.duration.Round(time.Millisecond)))
+			}
+		}
+	}
 	if len(deliveryErrs) > 0 {
 		logContent.WriteString("\n--- Runner Delivery Errors ---\n\n")
 		for _, err := range deliveryErrs {
@@ -49,20 +181,147 @@ func writeLogs(cfg *logConfig, runOut *runOutput, deliveryErrs []error) error {
 			logContent.WriteRune('\n')
 		}
 	}
+	return logContent.String(), nil
+}
+
+// jsonLogContent returns a single line of JSON describing the run. Its output field
+// contains the program's output (and any tail file or trace sections), without the
+// run summary which the other fields describe.
+func jsonLogContent(cfg *logConfig, runOut *runOutput, deliveryResults []deliveryResult, deliveryErrs []error) (string, error) {
+	logContent := jsonLog{
+		runResult:      runOut.result(),
+		SetupWarnings:  append([]string{}, runOut.setupWarnings...),
+		Deliveries:     []jsonLogDelivery{},
+		DeliveryErrors: []string{},
+	}
+	if !cfg.omitProgramOutput {
+		logContent.Output = strings.TrimPrefix(runOut.output, runOut.header+programOutputHeading)
+		logContent.Output = strings.TrimPrefix(logContent.Output, noProgramOutputNote)
+		logContent.Stdout = runOut.stdout
+		logContent.Stderr = runOut.stderr
+	}
+	for _, r := range deliveryResults {
+		d := jsonLogDelivery{
+			Channel:    r.channel,
+			DurationMs: r.duration.Milliseconds(),
+			Status:     "ok",
+			Detail:     r.detail,
+		}
+		switch {
+		case r.skipReason != "":
+			d.Status = "skipped"
+			d.Detail = r.skipReason
+		case r.err != nil:
+			d.Status = "failed"
+		}
+		logContent.Deliveries = append(logContent.Deliveries, d)
+	}
+	for _, err := range deliveryErrs {
+		logContent.DeliveryErrors = append(logContent.DeliveryErrors, err.Error())
+	}
 
-	err := writeLogFile(logFile, logContent.String())
+	retv, err := json.Marshal(logContent)
 	if err != nil {
-		return fmt.Errorf("failed to write log file '%s': %w", logFile, err)
+		return "", fmt.Errorf("failed to build JSON log: %w", err)
 	}
+	return string(retv) + "\n", nil
+}
 
-	if cfg.runAsUID != -1 || cfg.runAsGID != -1 {
-		err = os.Chown(logFile, cfg.runAsUID, cfg.runAsGID)
+// prepareLogDir validates the log directory per cfg.logRoot, creates it if necessary,
+// and returns the path to which logs should be written.
+func prepareLogDir(cfg *logConfig) (string, error) {
+	logDir := cfg.logDir
+	if cfg.logRoot != "" {
+		var err error
+		logDir, err = resolveLogDirWithinRoot(cfg.logDir, cfg.logRoot)
 		if err != nil {
-			return fmt.Errorf("failed to chown log file '%s' (%d, %d): %w", logFile, cfg.runAsUID, cfg.runAsGID, err)
+			return "", err
 		}
 	}
+	if _, err := os.Stat(logDir); os.IsNotExist(err) {
+		if err := mkdirAllOwned(logDir, defaultLogDirPerm, cfg.runAsUID, cfg.runAsGID); err != nil {
+			return "", err
+		}
+	}
+	return logDir, nil
+}
 
-	return nil
+// openLiveLog creates a log file to which the program's output is written as it runs.
+func openLiveLog(cfg *logConfig, jobName string, startTime time.Time) (*os.File, error) {
+	logDir, err := prepareLogDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	liveLogFile := filepath.Join(logDir, fmt.Sprintf("%s.%s.live.log",
+		removeBadFilenameChars(jobName),
+		startTime.Format("2006-01-02T15-04-05.000-0700"),
+	))
+	file, err := os.OpenFile(liveLogFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, defaultLogFilePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create live log file '%s': %w", liveLogFile, err)
+	}
+	if cfg.runAsUID != -1 || cfg.runAsGID != -1 {
+		if err := os.Chown(liveLogFile, cfg.runAsUID, cfg.runAsGID); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to chown live log file '%s' (%d, %d): %w", liveLogFile, cfg.runAsUID, cfg.runAsGID, err)
+		}
+	}
+	return file, nil
+}
+
+// resolveLogDirWithinRoot resolves any symlinks in logDir and logRoot, and returns the resolved
+// log directory if it is within the resolved root. Otherwise, it returns an error.
+// logDir need not exist yet; symlinks are resolved in the longest portion of its path which does.
+func resolveLogDirWithinRoot(logDir, logRoot string) (string, error) {
+	resolvedDir, err := evalExistingSymlinks(logDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve log directory '%s': %w", logDir, err)
+	}
+	resolvedDir, err = filepath.Abs(resolvedDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve log directory '%s': %w", logDir, err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(logRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve log root '%s': %w", logRoot, err)
+	}
+	resolvedRoot, err = filepath.Abs(resolvedRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve log root '%s': %w", logRoot, err)
+	}
+	rel, err := filepath.Rel(resolvedRoot, resolvedDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("log directory '%s' resolves to '%s', which is outside the log root '%s'; refusing to write logs",
+			logDir, resolvedDir, resolvedRoot)
+	}
+	return resolvedDir, nil
+}
+
+// evalExistingSymlinks is like filepath.EvalSymlinks, but allows trailing path components which don't exist.
+func evalExistingSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil || !os.IsNotExist(err) {
+		return resolved, err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return "", err
+	}
+	resolvedParent, err := evalExistingSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// anyDeliveryNotable returns true if any delivery was skipped or has details to report.
+func anyDeliveryNotable(results []deliveryResult) bool {
+	for _, r := range results {
+		if r.skipReason != "" || r.detail != "" {
+			return true
+		}
+	}
+	return false
 }
 
 func writeLogFile(filename, data string) error {
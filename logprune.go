@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logFileTimestampPattern matches the start time, as formatted in default log file names,
+// which follows the job name.
+var logFileTimestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3}[+-]\d{4}\.`)
+
+// Run status tags included in default log file names by -log-name-status:
+const (
+	logNameStatusOK      = "OK"
+	logNameStatusPartial = "PARTIAL"
+	logNameStatusFailed  = "FAILED"
+)
+
+// logNameStatusTag returns the tag describing the run's status in default log file names.
+func logNameStatusTag(runOut *runOutput) string {
+	switch {
+	case runOut.partial:
+		return logNameStatusPartial
+	case runOut.succeeded:
+		return logNameStatusOK
+	default:
+		return logNameStatusFailed
+	}
+}
+
+// pruneLogs deletes the given job's logs in the log directory which are older than
+// cfg.keepDays days, and all but the most recent cfg.keepCount of them. Only log files with
+// default names (see isJobLogFile) are considered; live logs are never deleted.
+func pruneLogs(cfg *logConfig, jobName string, now time.Time) error {
+	if cfg.logDir == "" || (cfg.keepDays <= 0 && cfg.keepCount <= 0) {
+		return nil
+	}
+
+	logDir, err := prepareLogDir(cfg)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return fmt.Errorf("failed to list log directory '%s': %w", logDir, err)
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var logFiles []logFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isJobLogFile(entry.Name(), jobName) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since listing the directory
+		}
+		logFiles = append(logFiles, logFile{filepath.Join(logDir, entry.Name()), info.ModTime()})
+	}
+	// newest first:
+	sort.Slice(logFiles, func(i, j int) bool {
+		return logFiles[i].modTime.After(logFiles[j].modTime)
+	})
+
+	var removeErrs []string
+	cutoff := now.AddDate(0, 0, -cfg.keepDays)
+	for i, f := range logFiles {
+		tooOld := cfg.keepDays > 0 && f.modTime.Before(cutoff)
+		tooMany := cfg.keepCount > 0 && i >= cfg.keepCount
+		if !tooOld && !tooMany {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			removeErrs = append(removeErrs, err.Error())
+		}
+	}
+	if len(removeErrs) > 0 {
+		return fmt.Errorf("failed to delete old log files: %s", strings.Join(removeErrs, "; "))
+	}
+	return nil
+}
+
+// isJobLogFile returns true if the given file name is a default log file name (as opposed
+// to one given by -log-name-template) for the given job, with or without a -log-name-status
+// tag, excluding live logs.
+// The file's start time is checked so that e.g. job "backup" doesn't match "backup.db"'s logs.
+func isJobLogFile(name, jobName string) bool {
+	prefix := removeBadFilenameChars(jobName) + "."
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	rest := name[len(prefix):]
+	for _, tag := range []string{logNameStatusOK, logNameStatusPartial, logNameStatusFailed} {
+		if strings.HasPrefix(rest, tag+".") {
+			rest = rest[len(tag)+1:]
+			break
+		}
+	}
+	if !logFileTimestampPattern.MatchString(rest) {
+		return false
+	}
+	return !strings.HasSuffix(name, ".live.log")
+}
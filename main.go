@@ -1,51 +1,136 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
+	"text/template"
 	"time"
 )
 
 var version = "<dev>"
 
+// Environment variables supporting job control:
+const (
+	TimeoutEnvVar = "RUNNER_TIMEOUT"
+)
+
 // Environment variables supporting email delivery:
 const (
-	MailToEnvVar      = "RUNNER_MAILTO"
-	MailFromEnvVar    = "RUNNER_MAIL_FROM"
-	SMTPUserEnvVar    = "RUNNER_SMTP_USER"
-	SMTPPassEnvVar    = "RUNNER_SMTP_PASS"
-	SMTPHostEnvVar    = "RUNNER_SMTP_HOST"
-	SMTPPortEnvVar    = "RUNNER_SMTP_PORT"
-	MailTabCharEnvVar = "RUNNER_MAIL_TAB_CHAR"
+	MailToEnvVar         = "RUNNER_MAILTO"
+	MailFromEnvVar       = "RUNNER_MAIL_FROM"
+	MailCcEnvVar         = "RUNNER_MAIL_CC"
+	MailBccEnvVar        = "RUNNER_MAIL_BCC"
+	SMTPUserEnvVar       = "RUNNER_SMTP_USER"
+	SMTPPassEnvVar       = "RUNNER_SMTP_PASS"
+	SMTPHostEnvVar       = "RUNNER_SMTP_HOST"
+	SMTPPortEnvVar       = "RUNNER_SMTP_PORT"
+	SMTPEncryptionEnvVar = "RUNNER_SMTP_ENCRYPTION"
+	MailTabCharEnvVar    = "RUNNER_MAIL_TAB_CHAR"
+	SMTPPassFileEnvVar   = "RUNNER_SMTP_PASS_FILE"
 )
 
 // Environment variables supporting ntfy delivery:
 const (
-	NtfyServerEnvVar      = "RUNNER_NTFY_SERVER"
-	NtfyTopicEnvVar       = "RUNNER_NTFY_TOPIC"
-	NtfyTagsEnvVar        = "RUNNER_NTFY_TAGS"
-	NtfyPriorityEnvVar    = "RUNNER_NTFY_PRIORITY"
-	NtfyEmailEnvVar       = "RUNNER_NTFY_EMAIL"
-	NtfyAccessTokenEnvVar = "RUNNER_NTFY_ACCESS_TOKEN"
+	NtfyServerEnvVar          = "RUNNER_NTFY_SERVER"
+	NtfyTopicEnvVar           = "RUNNER_NTFY_TOPIC"
+	NtfyTagsEnvVar            = "RUNNER_NTFY_TAGS"
+	NtfyPriorityEnvVar        = "RUNNER_NTFY_PRIORITY"
+	NtfyEmailEnvVar           = "RUNNER_NTFY_EMAIL"
+	NtfyAccessTokenEnvVar     = "RUNNER_NTFY_ACCESS_TOKEN"
+	NtfyAccessTokenFileEnvVar = "RUNNER_NTFY_ACCESS_TOKEN_FILE"
+	NtfyClickEnvVar           = "RUNNER_NTFY_CLICK"
 )
 
 // Environment variables supporting Discord delivery:
 const (
-	DiscordWebhookEnvVar = "RUNNER_DISCORD_WEBHOOK"
+	DiscordWebhookEnvVar     = "RUNNER_DISCORD_WEBHOOK"
+	DiscordWebhookFileEnvVar = "RUNNER_DISCORD_WEBHOOK_FILE"
+)
+
+// Environment variables supporting Zulip delivery:
+const (
+	ZulipSiteEnvVar   = "RUNNER_ZULIP_SITE"
+	ZulipEmailEnvVar  = "RUNNER_ZULIP_EMAIL"
+	ZulipAPIKeyEnvVar = "RUNNER_ZULIP_API_KEY"
+	ZulipStreamEnvVar = "RUNNER_ZULIP_STREAM"
+	ZulipTopicEnvVar  = "RUNNER_ZULIP_TOPIC"
+)
+
+// Environment variables supporting WhatsApp gateway delivery:
+const (
+	WhatsAppURLEnvVar   = "RUNNER_WHATSAPP_URL"
+	WhatsAppTokenEnvVar = "RUNNER_WHATSAPP_TOKEN"
+	WhatsAppToEnvVar    = "RUNNER_WHATSAPP_TO"
+)
+
+// Environment variables supporting Gotify delivery:
+const (
+	GotifyServerEnvVar   = "RUNNER_GOTIFY_SERVER"
+	GotifyTokenEnvVar    = "RUNNER_GOTIFY_TOKEN"
+	GotifyPriorityEnvVar = "RUNNER_GOTIFY_PRIORITY"
+)
+
+// Environment variables supporting Matrix delivery:
+const (
+	MatrixHomeserverEnvVar = "RUNNER_MATRIX_HOMESERVER"
+	MatrixTokenEnvVar      = "RUNNER_MATRIX_TOKEN"
+	MatrixRoomIDEnvVar     = "RUNNER_MATRIX_ROOM_ID"
+)
+
+// Environment variables supporting PagerDuty delivery:
+const (
+	PagerDutyRoutingKeyEnvVar = "RUNNER_PAGERDUTY_ROUTING_KEY"
+)
+
+// Environment variables supporting Amazon SNS delivery:
+const (
+	SNSTopicARNEnvVar = "RUNNER_SNS_TOPIC_ARN"
+	SNSRegionEnvVar   = "RUNNER_SNS_REGION"
+)
+
+// Environment variables supporting generic webhook delivery:
+const (
+	WebhookURLEnvVar = "RUNNER_WEBHOOK_URL"
 )
 
 // Environment variables supporting success notification delivery:
 const (
 	SuccessNotifyEnvVar = "RUNNER_SUCCESS_NOTIFY"
+	SuccessURLEnvVar    = "RUNNER_SUCCESS_URL"
+	FailureURLEnvVar    = "RUNNER_FAILURE_URL"
+	HealthcheckEnvVar   = "RUNNER_HEALTHCHECK_URL"
+)
+
+// Environment variables supporting cross-host alert deduplication:
+const (
+	DedupDirEnvVar = "RUNNER_DEDUP_DIR"
+)
+
+// Environment variables supporting the failed notification spool:
+const (
+	SpoolDirEnvVar = "RUNNER_SPOOL_DIR"
+)
+
+// Environment variables supporting job state persistence:
+const (
+	StateDirEnvVar = "RUNNER_STATE_DIR"
+)
+
+// Environment variables supporting configuration files:
+const (
+	ConfigFileEnvVar = "RUNNER_CONFIG"
 )
 
 // Environment variables supporting output redirection:
@@ -61,6 +146,12 @@ const (
 
 	HideEnvVarsEnvVar   = "RUNNER_HIDE_ENV"
 	CensorEnvVarsEnvVar = "RUNNER_CENSOR_ENV"
+	ShowEnvVarsEnvVar   = "RUNNER_SHOW_ENV"
+
+	HostnameEnvVar = "RUNNER_HOSTNAME"
+
+	// NoColorEnvVar follows the https://no-color.org convention.
+	NoColorEnvVar = "NO_COLOR"
 )
 
 func usage() {
@@ -76,7 +167,7 @@ func usage() {
 	flag.PrintDefaults()
 	_, _ = fmt.Fprintf(os.Stderr, "\nEnvironment variable-only options:\n")
 	_, _ = fmt.Fprintf(os.Stderr, "  %s\n    \tColon-separated list of environment variables whose values will be censored in output."+
-		"\n    \tRUNNER_SMTP_PASS and RUNNER_NTFY_ACCESS_TOKEN are always censored.\n", CensorEnvVarsEnvVar)
+		"\n    \tRUNNER_SMTP_PASS, RUNNER_NTFY_ACCESS_TOKEN, RUNNER_ZULIP_API_KEY, RUNNER_WHATSAPP_TOKEN, RUNNER_GOTIFY_TOKEN, RUNNER_MATRIX_TOKEN, and RUNNER_PAGERDUTY_ROUTING_KEY are always censored.\n", CensorEnvVarsEnvVar)
 	_, _ = fmt.Fprintf(os.Stderr, "  %s\n    \tColon-separated list of environment variables which will be entirely omitted from output.\n", HideEnvVarsEnvVar)
 	_, _ = fmt.Fprintf(os.Stderr, "\nVersion:\n  runner %s\n", version)
 	_, _ = fmt.Fprintf(os.Stderr, "\nGitHub:\n  https://github.com/cdzombak/runner\n")
@@ -86,19 +177,41 @@ func usage() {
 func main() {
 	implementOutputFdRedirect()
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "<unknown hostname>"
-		log.Printf("Failed to get hostname: %s", err)
-	}
-
 	// job control flags:
 	var healthyExitCodes IntSlice
 	flag.Var(&healthyExitCodes, "healthy-exit", "\"Healthy\" or \"success\" exit codes. "+
 		"May be specified multiple times to provide more than one success exit code. (default: 0)")
 	retries := flag.Int("retries", 0, "If the command fails, retry it this many times.")
+	retryBackoff := flag.Bool("retry-backoff", false, "Double the delay given by -retry-delay after each retry (e.g. 2, 4, 8... seconds).")
+	retryJitter := flag.Int("retry-jitter", 0, "If set, randomly adjust each delay between retries by up to this percentage (e.g. 20 for ±20%), so that hosts running the same job don't retry in lockstep.")
+	retryMaxDelay := flag.Int("retry-max-delay", 0, "If set, cap the delay between retries, as increased by -retry-backoff, at this many seconds.")
+	retryUntilMatch := flag.String("retry-until-match", "", "If set, the run succeeds only when the program's output contains this (case-sensitive) string, regardless of exit code; "+
+		"otherwise it is re-run, up to -retries times. Useful for polling until something is ready.")
 	retryDelayInt := flag.Int("retry-delay", 0, "If the command fails, wait this many seconds before retrying.")
-	timeout := flag.Int("timeout", 0, "Maximum number of seconds for the program's execution. If retries are allowed, each try may take this long. The timeout given does not include retry delay.")
+	timeout := flag.Int("timeout", 0, "Maximum number of seconds for the program's execution. If retries are allowed, each try may take this long; a try that times out is stopped and retried. The timeout given does not include retry delay. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", TimeoutEnvVar))
+	attemptTimeout := flag.Int("attempt-timeout", 0, "Alias for -timeout, which already limits each try. If both are given, -timeout wins.")
+	maxRuntime := flag.Int("max-runtime", 0, "Maximum number of seconds for the entire run, including all retries and retry delays. "+
+		"A try still running when this is exceeded is stopped like one that times out, and no further retries are made. "+
+		"Each try is limited by the lesser of -timeout and the time remaining under -max-runtime.")
+	idleTimeout := flag.Duration("idle-timeout", 0, "If set, stop a try that produces no output for this long (e.g. 2m), as if it had timed out. "+
+		"This is independent of -timeout.")
+	timeoutKillGrace := flag.Int("timeout-kill-grace", 10, "When a try times out, it is sent SIGTERM (or the signal given by -graceful-signal), and killed if it hasn't exited after this many seconds. "+
+		"Its output is captured until it exits or is killed. If 0, a try that times out is killed immediately.")
+	gracefulSignal := flag.String("graceful-signal", "SIGTERM", "Signal used to ask the program to exit before it is killed (see -timeout-kill-grace). One of SIGHUP, SIGINT, SIGQUIT, or SIGTERM. Ignored on Windows.")
+	killOnDeath := flag.Bool("kill-children-on-death", killChildrenOnDeathDefault, "Linux only: have the kernel send the program SIGTERM if runner itself dies (e.g. is sent SIGKILL). Ignored on other platforms.")
+	retraceOnFailure := flag.Bool("retrace-on-failure", false, "If the program fails, re-run it once under \"strace -f\" and attach the trace to Discord and email notifications. "+
+		"Requires strace to be installed; mainly useful on Linux.")
+	retraceTimeout := flag.Int("retrace-timeout", 60, "Maximum number of seconds for the re-run under strace requested by -retrace-on-failure.")
+	onSuccess := flag.String("on-success", "", "If set, run this shell command after the program if it succeeds, and include its output in the run's output. "+
+		"The command's exit status doesn't affect runner's.")
+	onFailure := flag.String("on-failure", "", "If set, run this shell command after the program if it fails, and include its output in the run's output. "+
+		"The command's exit status doesn't affect runner's.")
+	preRun := flag.String("pre-run", "", "If set, run this shell command before the program; if it fails, the program isn't run, and runner exits silently (see -pre-run-required). "+
+		"Its output is included in the run's output.")
+	preRunRequired := flag.Bool("pre-run-required", false, "If the -pre-run command fails, report the run as failed (printing and delivering its output as usual) instead of exiting silently.")
+	partialDuration := flag.Int("partial-duration", 0, "If the program succeeds but runs for longer than this many seconds, report the run as partially successful. "+
+		"Partial runs are printed/delivered like failures, but still trigger -success-notify.")
 
 	// output configuration flags:
 	var printIfMatch StringSlice
@@ -107,13 +220,80 @@ func main() {
 		"May be specified multiple times.")
 	flag.Var(&printIfNotMatch, "print-if-not-match", "Print/mail output if the given (case-sensitive) string does not appear in the program's output, even if it was a healthy exit. "+
 		"May be specified multiple times.")
+	var printIfMatchRegex StringSlice
+	var printIfNotMatchRegex StringSlice
+	flag.Var(&printIfMatchRegex, "print-if-match-regex", "Print/mail output if the given regular expression (Go RE2 syntax) matches the program's output, even if it was a healthy exit. "+
+		"May be specified multiple times.")
+	flag.Var(&printIfNotMatchRegex, "print-if-not-match-regex", "Print/mail output if the given regular expression (Go RE2 syntax) does not match the program's output, even if it was a healthy exit. "+
+		"May be specified multiple times.")
+	var printIfStderrMatch StringSlice
+	flag.Var(&printIfStderrMatch, "print-if-stderr-match", "Print/mail output if the given (case-sensitive) string appears in the program's stderr, even if it was a healthy exit. "+
+		"Implies -separate-streams. May be specified multiple times.")
+	separateStreams := flag.Bool("separate-streams", false, "Capture the program's stdout and stderr separately (as well as combined, for output), so that stderr can be matched by -print-if-stderr-match.")
+	var tailFileSpecs StringSlice
+	flag.Var(&tailFileSpecs, "tail-file", "Append the last N lines of the file at PATH to the output after the program runs, in the form PATH:N. "+
+		"May be specified multiple times.")
+	durationHistory := flag.Int("duration-history", 0, "If set, compare the run's duration to the average of this many recent successful runs of the job, in the summary. "+
+		"Requires a state directory (see -state-dir).")
+	outputPrefix := flag.String("output-prefix", "", "Prepend this text to the output in notifications, e.g. to mention a group or link to a runbook. "+
+		"It's a Go text/template; available fields: JobName, Hostname, StartTime, Status, ExitCode, SummaryLine, Emoji.")
+	outputSuffix := flag.String("output-suffix", "", "Append this text to the output in notifications. Like -output-prefix, it's a Go text/template.")
+	notifyTitleFromOutput := flag.Bool("notify-title-from-output", false, "Append the first non-empty line of the program's output to the summary line used as the title/subject of notifications. "+
+		"The log file and printed output are unaffected.")
+	includeSystemStats := flag.Bool("include-system-stats", false, "Include the system's load average and memory usage, as of the end of the run, in the summary. Linux only; ignored on other platforms.")
+	noEmoji := flag.Bool("no-emoji", false, "Use plain text markers such as [FAIL] and [OK] instead of status emoji in notifications. "+
+		fmt.Sprintf("Implied if the %s environment variable is set.", NoColorEnvVar))
+	minimalSummary := flag.Bool("minimal-summary", false, "Trim the summary preceding the program's output to the host, status, job name, exit code, and duration. "+
+		"The environment, working directory, command, start/end times, retries, and run-as user are omitted.")
 	alwaysPrint := flag.Bool("always-print", false, "Always print/mail the program's output, sidestepping exit code and -print-if[-not]-match checks.")
+	tee := flag.Bool("tee", false, "Always print the output, but deliver it only if the program fails or its output would otherwise be printed (unlike -always-print, which does both).")
+	printSummaryLine := flag.Bool("print-summary-line", false, "Always print the one-line run summary (e.g. \"[host] Failed running job\") to stdout, even if the program's output is not printed.")
+	propagateExit := flag.Bool("propagate-exit", false, "After printing, delivering, and logging the run's output, exit with the program's exit code (or 1 if it didn't exit normally), instead of 0.")
+	quiet := flag.Bool("quiet", false, "When printing the program's output, omit the summary, environment, and setup warnings that normally precede it. "+
+		"Notifications and log files still include them.")
 	printToStderr := flag.Bool("print-stderr", false, "Print output to stderr instead of stdout (if this flag is not given, output is printed to stdout).")
+	hostnameOverride := flag.String("hostname", "", "Hostname used in the summary line, notifications, and logs. (default: the system's hostname) "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", HostnameEnvVar))
 	jobName := flag.String("job-name", "", "Job name used in failure notifications and log file name. (default: program name, without path)")
+	displayName := flag.String("display-name", "", "Friendly name (e.g. \"Nightly Postgres Backup\") used in place of the job name in the summary line and notification titles. "+
+		"The job name is still used for log file names and job state.")
 	hideEnv := flag.Bool("hide-env", false, "Hide the process's environment, which is normally printed & logged as part of the output.")
+	showEnvVars := flag.String("show-env", "", "Colon-separated list of environment variables to print; if set, all other variables are omitted from the output. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ShowEnvVarsEnvVar))
+	printEnvDiff := flag.Bool("print-env-diff", false, "Instead of printing the full environment, print only the variables which differ between runner's environment and the program's environment.")
 	logDir := flag.String("log-dir", "", "The directory to write run logs to. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", LogDirEnvVar))
+	logDefaultDir := flag.Bool("log-default-dir", false, "If no log directory is given, write logs to $XDG_STATE_HOME/runner (or ~/.local/state/runner if XDG_STATE_HOME is unset). "+
+		"When running the program as another user, that user's ~/.local/state/runner is used.")
+	maxOutputBytes := flag.Int("max-output-bytes", 0, "If set, retain at most this many bytes of each try's output for matching, printing, and delivery: the first and last halves, with a note in between saying how much was truncated. "+
+		"-live-log still receives the full output, and the live log is kept after the run. (default: 0, meaning unlimited)")
+	liveLog := flag.Bool("live-log", false, "Write the program's output to a file in the log directory as it runs, so it can be followed (e.g. with tail -f) during long runs. "+
+		"The file is removed once the run's log has been written.")
+	logRoot := flag.String("log-root", "", "If set, refuse to write logs unless the log directory, after resolving any symlinks, is within this directory. "+
+		"This guards against a symlink in the log directory's path redirecting logs elsewhere.")
+	shell := flag.Bool("shell", false, "Run the command line given after the flags through a shell ($SHELL -c, or /bin/sh -c if SHELL isn't set; cmd /C on Windows), "+
+		"so it may use pipes, redirection, and globs. Multiple arguments are joined with spaces.")
 	workDir := flag.String("work-dir", "", "Set the working directory for the program.")
+	workDirCreate := flag.Bool("work-dir-create", false, "Create the directory given by -work-dir, and any missing parents, if it doesn't exist. "+
+		"When running the program as another user, that user owns the directories created.")
+	var envVars StringSlice
+	flag.Var(&envVars, "env", "Set the given variable, in the form KEY=VALUE, in the program's environment, overriding runner's own and -env-file's. May be specified multiple times.")
+	clearEnv := flag.Bool("clear-env", false, "Run the program with a minimal environment, containing only HOME, PATH, and any variables given by -env-file or -env, instead of runner's full environment.")
+	envFile := flag.String("env-file", "", "Add the variables in this dotenv-style file (KEY=VALUE lines) to the program's environment, overriding runner's own.")
+	logErrorsNonfatal := flag.Bool("log-errors-nonfatal", false, "If writing the log file fails, print the error to stderr but exit normally instead of exiting with an error.")
+	logJSONHeader := flag.Bool("log-json-header", false, "Begin each log file with a single line of JSON describing the run, followed by the usual human-readable log.")
+	logFormat := flag.String("log-format", logFormatText, fmt.Sprintf("Format of log files: %s, or %s for a single JSON object per run.", logFormatText, logFormatJSON))
+	logExt := flag.String("log-ext", "log", "File extension for log files.")
+	logNameTemplate := flag.String("log-name-template", "", "Go text/template for log file names, relative to the log directory, which may include subdirectories "+
+		"(e.g. {{.JobName}}/{{.StartTime.Format \"2006-01-02\"}}.log). Available fields: JobName, Hostname, StartTime, Status, ExitCode. (default: JobName.StartTime.log)")
+	logNameStatus := flag.Bool("log-name-status", false, "Include the run's status (OK, PARTIAL, or FAILED) in default log file names, before the timestamp, e.g. JobName.FAILED.StartTime.log.")
+	logOmitOutput := flag.Bool("log-omit-output", false, "Omit the program's output from log files. The log still contains the run summary and delivery status, and notifications still contain the full output.")
+	logKeepDays := flag.Int("log-keep-days", 0, "If set, after writing the run's log, delete this job's logs which are older than this many days.")
+	logKeepCount := flag.Int("log-keep-count", 0, "If set, after writing the run's log, delete all but this many of this job's most recent logs.")
+	useSyslog := flag.Bool("syslog", false, "Write the run's summary line, and the output of failed runs, to the local syslog. Independent of -log-dir. Ignored on Windows.")
+	syslogTag := flag.String("syslog-tag", defaultSyslogTag, "Tag for messages written per -syslog.")
+	syslogFacility := flag.String("syslog-facility", defaultSyslogFacility, "Facility for messages written per -syslog, e.g. daemon or local0.")
+	logDeliveryLatency := flag.Bool("log-delivery-latency", false, "Include a section in the log file listing each delivery channel's status and how long it took.")
 
 	// run-as-user flags:
 	asUser := flag.String("user", "", "Run the program as the given user. Ignored on Windows. "+
@@ -122,22 +302,47 @@ func main() {
 		"(If provided, runner must be run as root or with CAP_SETUID.)")
 	asGID := flag.Int("gid", -1, "Run the program as the given GID. Ignored on Windows. "+
 		"(If provided, runner must be run as root or with CAP_SETGID.)")
+	noNewPrivs := flag.Bool("no-new-privs", false, "Prevent the program and its descendants from gaining privileges, e.g. via sudo or other setuid programs. Linux only.")
+	chroot := flag.String("chroot", "", "Run the program with this directory as its root directory; -work-dir and paths in the command are resolved within it. Ignored on Windows. "+
+		"(If provided, runner must be run as root or with CAP_SYS_CHROOT.)")
+	asGroups := flag.String("groups", "", "Comma-separated list of supplementary GIDs for the program run per -user/-uid. Ignored on Windows. "+
+		"(default: the user's group memberships)")
+
+	nice := flag.Int("nice", 0, "Run the program with this niceness (-20 to 19; higher values are lower priority). Ignored on Windows. "+
+		"(Negative values require that runner be run as root or with CAP_SYS_NICE.)")
+
+	ioniceClass := flag.String("ionice-class", "", "Run the program with this I/O scheduling class: realtime, best-effort, or idle. Linux only. "+
+		"(Realtime requires that runner be run as root or with CAP_SYS_ADMIN.) (default: best-effort if -ionice-level is given)")
+	ioniceLevel := flag.Int("ionice-level", defaultIOPriorityLevel, "Run the program with this I/O priority level within the realtime or best-effort class (0 to 7; higher values are lower priority). Linux only.")
 
 	// mail delivery flags:
-	mailTo := flag.String("mailto", "", "Send an email to the given address if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+	mailTo := flag.String("mailto", "", "Send an email to the given address (or comma-separated list of addresses) if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MailToEnvVar))
+	mailCc := flag.String("mail-cc", "", "Comma-separated list of addresses to CC on emails sent per -mailto. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MailCcEnvVar))
+	mailBcc := flag.String("mail-bcc", "", "Comma-separated list of addresses to BCC on emails sent per -mailto. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MailBccEnvVar))
 	mailFrom := flag.String("mail-from", "", "The email address to use as the From: address in failure emails. (default: runner@hostname) "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MailFromEnvVar))
 	smtpUser := flag.String("smtp-user", "", "Username for SMTP authentication. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SMTPUserEnvVar))
 	smtpPass := flag.String("smtp-pass", "", "Password for SMTP authentication. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SMTPPassEnvVar))
-	smtpHost := flag.String("smtp-host", "", "SMTP server hostname. "+
+	smtpPassFile := flag.String("smtp-pass-file", "", "Read the password for SMTP authentication from the first line of this file, if it isn't given by -smtp-pass. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SMTPPassFileEnvVar))
+	smtpHost := flag.String("smtp-host", "", "SMTP server hostname. May be a comma-separated list of hostnames, which are tried in order until one accepts a connection. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SMTPHostEnvVar))
 	smtpPort := flag.Int("smtp-port", 25, "SMTP server port. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SMTPPortEnvVar))
+	smtpEncryption := flag.String("smtp-encryption", "", "SMTP encryption mode: none, ssl (implicit TLS), starttls, or auto (SSL/TLS for port 465, STARTTLS for port 587, none otherwise). (default: auto) "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SMTPEncryptionEnvVar))
 	mailTabCharReplacement := flag.String("mail-tab-char", "", "Replace tab characters in emailed output by this string. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MailTabCharEnvVar))
+	mailAttachThreshold := flag.Int("mail-attach-threshold", 0, "If set, and the email body would be larger than this many bytes, attach the program's output to the email instead of including it in the body. "+
+		"This avoids messages being rejected by size-limited SMTP relays.")
+	mailAttachGzip := flag.Bool("mail-attach-gzip", false, "Gzip the output attached per -mail-attach-threshold.")
+	mailHTML := flag.Bool("mail-html", false, "Send emails with an HTML version of the output, in a monospace block under a header colored by the run's status, as well as the plain text version.")
+	mailAttachJSON := flag.Bool("mail-attach-json", false, "Attach a machine-readable result.json, describing the run, to emails.")
 
 	// ntfy delivery flags:
 	ntfyServer := flag.String("ntfy-server", "", "Send a notification to the given ntfy server if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
@@ -152,19 +357,174 @@ func main() {
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", NtfyEmailEnvVar))
 	ntfyAccessToken := flag.String("ntfy-access-token", "", "If set, use this access token for ntfy. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", NtfyAccessTokenEnvVar))
+	ntfyAccessTokenFile := flag.String("ntfy-access-token-file", "", "Read the ntfy access token from the first line of this file, if it isn't given by -ntfy-access-token. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", NtfyAccessTokenFileEnvVar))
+	ntfyClick := flag.String("ntfy-click", "", "If set, open this URL when the ntfy notification is tapped, e.g. a link to the job's logs. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", NtfyClickEnvVar))
+	var ntfyActionSpecs StringSlice
+	flag.Var(&ntfyActionSpecs, "ntfy-action", "Add an action button to the ntfy notification, in the form 'ACTION, LABEL, URL[, clear=true][, method=METHOD]', where ACTION is view or http. "+
+		"May be specified up to 3 times.")
+
+	// Notification priority flags:
+	var priorityForExitSpecs StringSlice
+	flag.Var(&priorityForExitSpecs, "priority-for-exit", "Map an exit code to a notification priority, in the form CODE=PRIORITY, where PRIORITY is between 1-5 (inclusive). "+
+		"This overrides -ntfy-priority and colors Discord messages. May be specified multiple times.")
 
 	// Discord delivery flag:
 	discordHookURL := flag.String("discord-webhook", "", "If set, post to this Discord webhook if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", DiscordWebhookEnvVar))
+	discordContent := flag.String("discord-content", "", "Go text/template for the content of Discord messages, e.g. to mention a role on failure. "+
+		"Available fields: JobName, Hostname, StartTime, Status, ExitCode, SummaryLine, Emoji. (default: {{.Emoji}} {{.SummaryLine}})")
+	discordUsername := flag.String("discord-username", "", "Override the Discord webhook's default username.")
+	discordAvatarURL := flag.String("discord-avatar-url", "", "Override the Discord webhook's default avatar with the image at this URL.")
+	discordHookURLFile := flag.String("discord-webhook-file", "", "Read the Discord webhook URL from the first line of this file, if it isn't given by -discord-webhook. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", DiscordWebhookFileEnvVar))
+
+	// Zulip delivery flags:
+	zulipSite := flag.String("zulip-site", "", "If set, post to this Zulip organization (e.g. https://example.zulipchat.com) if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ZulipSiteEnvVar))
+	zulipEmail := flag.String("zulip-email", "", "Email address of the Zulip bot used to post messages. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ZulipEmailEnvVar))
+	zulipAPIKey := flag.String("zulip-api-key", "", "API key of the Zulip bot used to post messages. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ZulipAPIKeyEnvVar))
+	zulipStream := flag.String("zulip-stream", "", "The Zulip stream to post to. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ZulipStreamEnvVar))
+	zulipTopic := flag.String("zulip-topic", "", "The Zulip topic to post to. (default: job name) "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ZulipTopicEnvVar))
+
+	// WhatsApp gateway delivery flags:
+	whatsAppURL := flag.String("whatsapp-url", "", "If set, POST a message to this WhatsApp gateway URL (e.g. a self-hosted WhatsApp Web bridge) if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", WhatsAppURLEnvVar))
+	whatsAppToken := flag.String("whatsapp-token", "", "If set, send this bearer token to the WhatsApp gateway. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", WhatsAppTokenEnvVar))
+	whatsAppTo := flag.String("whatsapp-to", "", "The recipient (phone number or chat ID, as expected by the gateway) of WhatsApp messages. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", WhatsAppToEnvVar))
+
+	// Gotify delivery flags:
+	gotifyServer := flag.String("gotify-server", "", "If set, push a message to this Gotify server if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", GotifyServerEnvVar))
+	gotifyToken := flag.String("gotify-token", "", "The Gotify application token used to push messages. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", GotifyTokenEnvVar))
+	gotifyPriority := flag.Int("gotify-priority", 0, "Priority for messages sent to Gotify, from 0-10. (default: 8 for failures, 5 for partial successes, and 2 for successes) "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", GotifyPriorityEnvVar))
+
+	// Matrix delivery flags:
+	matrixHomeserver := flag.String("matrix-homeserver", "", "If set, send a message via this Matrix homeserver (e.g. https://matrix.example.com) if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MatrixHomeserverEnvVar))
+	matrixToken := flag.String("matrix-token", "", "Access token of the Matrix user used to send messages. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MatrixTokenEnvVar))
+	matrixRoomID := flag.String("matrix-room-id", "", "ID of the Matrix room to send messages to (e.g. !abc123:example.com). "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", MatrixRoomIDEnvVar))
 
-	// Success notification delivery flag:
+	// PagerDuty delivery flags:
+	pagerdutyRoutingKey := flag.String("pagerduty-routing-key", "", "If set, trigger a PagerDuty incident, via the Events API v2 integration with this routing key, if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", PagerDutyRoutingKeyEnvVar))
+	pagerdutyAutoResolve := flag.Bool("pagerduty-auto-resolve", false, "Resolve the job's open PagerDuty incident when the program next succeeds.")
+
+	// Amazon SNS delivery flags:
+	snsTopicARN := flag.String("sns-topic-arn", "", "If set, publish a message to this Amazon SNS topic if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		"AWS credentials are found via the AWS SDK's default credential chain. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SNSTopicARNEnvVar))
+	snsRegion := flag.String("sns-region", "", "AWS region of the SNS topic. (default: the topic ARN's region) "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SNSRegionEnvVar))
+
+	// Generic webhook delivery flag:
+	webhookURL := flag.String("webhook-url", "", "If set, POST a JSON description of the run, including its output, to this URL if the program fails or its output would otherwise be printed per -healthy-exit/-print-if-[not]-match/-always-print. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", WebhookURLEnvVar))
+	var webhookURLHeaderSpecs StringSlice
+	flag.Var(&webhookURLHeaderSpecs, "webhook-url-header", "Add the given header, in the form NAME=VALUE (e.g. Authorization=Bearer abc123), to requests to -webhook-url only. "+
+		"May be specified multiple times.")
+
+	// Success/failure notification delivery flags:
 	successNotifyURL := flag.String("success-notify", "", "If set, GET this URL if the program succeeds. This is useful in conjunction with e.g. Uptime Kuma's push monitors. "+
 		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SuccessNotifyEnvVar))
+	successURL := flag.String("success-url", "", "Like -success-notify, and takes precedence over it. The placeholders {exit_code} and {status} in the URL are replaced by the run's exit code and status. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SuccessURLEnvVar))
+	failureURL := flag.String("failure-url", "", "If set, GET this URL if the program fails. The placeholders {exit_code} and {status} in the URL are replaced by the run's exit code and status. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", FailureURLEnvVar))
+
+	healthcheckURL := flag.String("healthcheck-url", "", "If set, ping this healthchecks.io check URL: URL/start before running the program, then URL if it succeeds or URL/fail (with its output) if it fails. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", HealthcheckEnvVar))
+	successFile := flag.String("success-file", "", "If set, touch this file (creating it if necessary) after each successful run, "+
+		"so that external monitoring can alert if its modification time grows stale.")
+	metricsFile := flag.String("metrics-file", "", "If set, write Prometheus metrics describing the run to this file (e.g. for node_exporter's textfile collector) after each run.")
+
+	// Start notification flags:
+	notifyOnStart := flag.Bool("notify-on-start", false, "Send a brief \"job started\" notification via the configured delivery channels before running the program.")
+	notifyOnStartChannels := flag.String("notify-on-start-channels", "", "Comma-separated list of delivery channels which receive the -notify-on-start notification. "+
+		fmt.Sprintf("Each is one of: %s. (default: all configured channels)", strings.Join(allChannels(), ", ")))
+
+	minConsecutiveFailures := flag.Int("min-consecutive-failures", 0, "If set, deliver failure notifications only once the job has failed this many times in a row. "+
+		"The streak resets whenever the job succeeds. Requires a state directory (see -state-dir).")
+	notifyOn := flag.String("notify-on", notifyOnFailure, fmt.Sprintf("When to deliver notifications: %s (when the program fails or its output would otherwise be printed), %s, %s, or %s (equivalent to -notify-on-transition).",
+		notifyOnFailure, notifyOnSuccess, notifyOnAlways, notifyOnChange))
+	notifyMinDuration := flag.Int("notify-min-duration", 0, "If set, don't deliver notifications for failed runs which took less than this many seconds, "+
+		"e.g. due to a typo in the command. The log is still written.")
+	notifyMaxDuration := flag.Int("notify-max-duration", 0, "If set, deliver notifications for successful runs which took longer than this many seconds, "+
+		"without otherwise treating them as failures (unlike -partial-duration).")
+	notifyOnTransition := flag.Bool("notify-on-transition", false, "Deliver notifications only when the job's status (succeeded, failed, or partially succeeded) differs from the previous run's, "+
+		"including when a failing job recovers. Requires a state directory (see -state-dir).")
+
+	// Per-channel throttling flags:
+	notifyCooldown := flag.Duration("notify-cooldown", 0, "If set, suppress all deliveries within this long (e.g. 1h) of the last notification. "+
+		"The next notification notes how many were suppressed. Requires a state directory (see -state-dir).")
+	var throttleSpecs StringSlice
+	flag.Var(&throttleSpecs, "throttle", "Deliver via the given channel at most once per the given interval, in the form CHANNEL=DURATION (e.g. mail=1h). "+
+		fmt.Sprintf("CHANNEL is one of: %s. May be specified multiple times. Requires a state directory (see -state-dir).", strings.Join(allChannels(), ", ")))
+
+	// Cross-host alert deduplication flags:
+	dedupDir := flag.String("dedup-dir", "", "If set, use this directory (shared between hosts, e.g. via NFS) to deduplicate alerts for this job across hosts. "+
+		"The first host to alert claims the alert for -dedup-window; other hosts suppress their deliveries during that window. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", DedupDirEnvVar))
+	dedupWindow := flag.Int("dedup-window", 300, "Number of seconds for which an alert claimed via -dedup-dir suppresses other hosts' alerts.")
+
+	deliveryTimeout := flag.Int("delivery-timeout", 0, "Maximum number of seconds for each delivery (email, ntfy, Discord, etc.) and success/failure notification. (default: 0, meaning each channel's default of 10 seconds)")
+
+	// HTTP delivery flags:
+	var webhookHeaderSpecs StringSlice
+	flag.Var(&webhookHeaderSpecs, "webhook-header", "Add the given header, in the form NAME=VALUE, to ntfy, Discord, and webhook delivery requests, unless the request already sets it. "+
+		"May be specified multiple times.")
+
+	// Failed notification spool flags:
+	spoolDir := flag.String("spool-dir", "", "If set, save notifications which fail to deliver in this directory, and try to re-deliver them on later runs (of any job using this spool directory). "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", SpoolDirEnvVar))
+	spoolMaxAge := flag.Duration("spool-max-age", 24*time.Hour, "Give up on re-delivering a spooled notification once it is this old.")
 
+	// TLS flags:
+	var caCertFiles StringSlice
+	flag.Var(&caCertFiles, "ca-cert", "Trust the CA certificate(s) in the given PEM file, in addition to the system trust store, for all deliveries (SMTP and HTTPS). "+
+		"May be specified multiple times.")
+	clientCert := flag.String("client-cert", "", "Present the client certificate in this PEM file for mutual TLS authentication to delivery endpoints. Requires -client-key.")
+	clientKey := flag.String("client-key", "", "Private key (PEM) for the certificate given by -client-cert.")
+
+	stateDir := flag.String("state-dir", "", "Directory in which to persist per-job state between runs, for features which require it. (default: runner subdirectory of the user cache directory) "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", StateDirEnvVar))
+
+	// Overlapping run prevention flags:
+	lockFile := flag.String("lock-file", "", "If set, hold an exclusive lock on this file while running the program. If another runner holds the lock, exit quietly (with status 0) without running the program.")
+	singleInstance := flag.Bool("single-instance", false, "Like -lock-file, using a lock file named after the job name in the state directory (see -state-dir).")
+	lockWait := flag.Int("lock-wait", 0, "If the lock requested by -lock-file or -single-instance is held, wait up to this many seconds for it to be released before giving up.")
+
+	trapPanics := flag.Bool("trap-panics", true, "If runner itself crashes, try to send a crash notification via the first working delivery channel and write a crash log before exiting.")
+
+	testDelivery := flag.Bool("test-delivery", false, "Instead of running a program, send a test notification via each configured delivery channel, print the results, and exit. "+
+		"Exits with status 1 if any delivery fails.")
+	configFile := flag.String("config", "", "Load default values for options from this TOML file, whose keys are option names (e.g. smtp-host = \"mail.example.com\"). "+
+		"Options given on the command line override the file, and the file overrides environment variables. "+
+		fmt.Sprintf("Can also be set by the %s environment variable; this flag overrides the environment variable.", ConfigFileEnvVar))
 	printVersion := flag.Bool("version", false, "Print version and exit.")
 	flag.Usage = usage
 	flag.Parse()
 
+	if *configFile == "" {
+		*configFile = os.Getenv(ConfigFileEnvVar)
+	}
+	var configFileErr error
+	var configOptionErrs []error
+	if *configFile != "" {
+		configOptionErrs, configFileErr = applyConfigFile(*configFile)
+	}
+
 	if *printVersion {
 		fmt.Println(version)
 		os.Exit(0)
@@ -172,40 +532,216 @@ func main() {
 
 	// Configuration and validation:
 
+	if *hostnameOverride == "" {
+		*hostnameOverride = os.Getenv(HostnameEnvVar)
+	}
+	hostname := *hostnameOverride
+	var err error
+	if hostname == "" {
+		hostname, err = os.Hostname()
+		if err != nil {
+			hostname = "<unknown hostname>"
+			log.Printf("Failed to get hostname: %s", err)
+		}
+	}
+
+	if *showEnvVars == "" {
+		*showEnvVars = os.Getenv(ShowEnvVarsEnvVar)
+	}
+	var shownEnvVars []string
+	for _, name := range strings.Split(*showEnvVars, ":") {
+		if name != "" {
+			shownEnvVars = append(shownEnvVars, name)
+		}
+	}
+
 	runCfg := &runConfig{
 		programName:      flag.Arg(0),
 		workDir:          *workDir,
+		clearEnv:         *clearEnv,
+		nice:             *nice,
 		healthyExitCodes: healthyExitCodes,
 		retries:          *retries,
+		retryUntilMatch:  *retryUntilMatch,
+		retryBackoff:     *retryBackoff,
+		retryMaxDelay:    time.Duration(*retryMaxDelay) * time.Second,
+		killGrace:        time.Duration(*timeoutKillGrace) * time.Second,
+		gracefulSignal:   defaultGracefulSignal,
+		killOnDeath:      *killOnDeath,
+		retraceOnFailure: *retraceOnFailure,
+		retraceTimeout:   time.Duration(*retraceTimeout) * time.Second,
+		onSuccess:        *onSuccess,
+		onFailure:        *onFailure,
+		maxOutputBytes:   *maxOutputBytes,
+		separateStreams:  *separateStreams || len(printIfStderrMatch) > 0,
 		outputConfig: &runOutputConfig{
-			jobName:         *jobName,
-			hostname:        hostname,
-			hideEnv:         *hideEnv,
-			alwaysPrint:     *alwaysPrint,
-			printIfMatch:    printIfMatch,
-			printIfNotMatch: printIfNotMatch,
+			jobName:            *jobName,
+			displayName:        *displayName,
+			hostname:           hostname,
+			hideEnv:            *hideEnv,
+			shownEnvVars:       shownEnvVars,
+			printEnvDiff:       *printEnvDiff,
+			minimalSummary:     *minimalSummary,
+			noEmoji:            *noEmoji || os.Getenv(NoColorEnvVar) != "",
+			systemStats:        *includeSystemStats,
+			alwaysPrint:        *alwaysPrint,
+			printIfMatch:       printIfMatch,
+			printIfNotMatch:    printIfNotMatch,
+			printIfStderrMatch: printIfStderrMatch,
 		},
 		runAsUser: nil,
 	}
-	if runCfg.programName == "" {
+	if runCfg.programName == "" && !*testDelivery {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if configFileErr != nil {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to load -config file '%s'; ignoring it: %s", *configFile, configFileErr))
+	}
+	for _, err := range configOptionErrs {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid option in -config file '%s': %s", *configFile, err))
+	}
+	if *envFile != "" {
+		if runCfg.extraEnv, err = parseEnvFile(*envFile); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to load -env-file '%s'; ignoring it: %s", *envFile, err))
+		}
+	}
+	for _, envVar := range envVars {
+		if eq := strings.Index(envVar, "="); eq < 1 {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -env '%s'; it must have the form KEY=VALUE.", envVar))
+			continue
+		}
+		runCfg.extraEnv = append(runCfg.extraEnv, envVar)
+	}
 	if len(flag.Args()) > 1 {
 		runCfg.programArgs = flag.Args()[1:]
 	}
-	if runCfg.outputConfig.jobName == "" {
+	if runCfg.outputConfig.jobName == "" && runCfg.programName == "" {
+		runCfg.outputConfig.jobName = "test-delivery"
+	} else if runCfg.outputConfig.jobName == "" {
 		runCfg.outputConfig.jobName = filepath.Base(runCfg.programName)
 	}
+	if *shell && runCfg.programName != "" {
+		command := strings.Join(flag.Args(), " ")
+		if *jobName == "" {
+			// name the job for the command line's first word, rather than the shell:
+			if words := strings.Fields(command); len(words) > 0 {
+				runCfg.outputConfig.jobName = filepath.Base(words[0])
+			}
+		}
+		runCfg.programName, runCfg.programArgs = shellCommand(command)
+	}
 	if len(runCfg.healthyExitCodes) == 0 {
 		runCfg.healthyExitCodes = []int{0}
 	}
 	if *retryDelayInt > 0 {
 		runCfg.retryDelay = time.Duration(*retryDelayInt) * time.Second
 	}
+	if WasFlagGiven("attempt-timeout") {
+		if !WasFlagGiven("timeout") {
+			*timeout = *attemptTimeout
+		} else if *attemptTimeout != *timeout {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring -attempt-timeout %d; -timeout %d was also given.", *attemptTimeout, *timeout))
+		}
+	}
+	if os.Getenv(TimeoutEnvVar) != "" && !WasFlagGiven("timeout") && !WasFlagGiven("attempt-timeout") {
+		timeoutStr := os.Getenv(TimeoutEnvVar)
+		*timeout, err = strconv.Atoi(timeoutStr)
+		if err != nil {
+			log.Fatalf("Failed to parse %s ('%s') as integer: %s", TimeoutEnvVar, timeoutStr, err)
+		}
+	}
 	if *timeout > 0 {
 		runCfg.timeout = time.Duration(*timeout) * time.Second
 	}
+	if *retryJitter < 0 || *retryJitter > 100 {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -retry-jitter %d; it must be between 0 and 100.", *retryJitter))
+	} else {
+		runCfg.retryJitter = *retryJitter
+	}
+	if *maxRuntime > 0 {
+		runCfg.maxRuntime = time.Duration(*maxRuntime) * time.Second
+	}
+	if *idleTimeout > 0 {
+		runCfg.idleTimeout = *idleTimeout
+	}
+	if sig, err := parseSignal(*gracefulSignal); err != nil {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -graceful-signal: %s; using SIGTERM.", err))
+	} else {
+		runCfg.gracefulSignal = sig
+	}
+	//goland:noinspection GoBoolExpressions
+	if runtime.GOOS == "windows" && WasFlagGiven("graceful-signal") {
+		runCfg.outputConfig.addSetupWarning("-graceful-signal is not supported on Windows; the program will be killed instead.")
+	}
+	if *partialDuration > 0 {
+		runCfg.partialDuration = time.Duration(*partialDuration) * time.Second
+	}
+
+	for _, spec := range priorityForExitSpecs {
+		code, priority, err := parsePriorityForExit(spec)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -priority-for-exit: %s", err))
+			continue
+		}
+		if runCfg.outputConfig.priorityForExit == nil {
+			runCfg.outputConfig.priorityForExit = make(map[int]int)
+		}
+		runCfg.outputConfig.priorityForExit[code] = priority
+	}
+
+	for _, pattern := range printIfMatchRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -print-if-match-regex '%s': %s", pattern, err))
+			continue
+		}
+		runCfg.outputConfig.printIfMatchRe = append(runCfg.outputConfig.printIfMatchRe, re)
+	}
+	for _, pattern := range printIfNotMatchRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -print-if-not-match-regex '%s': %s", pattern, err))
+			continue
+		}
+		runCfg.outputConfig.printIfNotMatchRe = append(runCfg.outputConfig.printIfNotMatchRe, re)
+	}
+	for _, spec := range tailFileSpecs {
+		tailFile, err := parseTailFile(spec)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -tail-file: %s", err))
+			continue
+		}
+		runCfg.outputConfig.tailFiles = append(runCfg.outputConfig.tailFiles, tailFile)
+	}
+
+	if *nice < -20 || *nice > 19 {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -nice %d: must be between -20 and 19.", *nice))
+		runCfg.nice = 0
+	}
+
+	if *ioniceClass != "" || WasFlagGiven("ionice-level") {
+		class := ioPriorityClassBestEffort
+		var err error
+		if *ioniceClass != "" {
+			class, err = parseIOPriorityClass(*ioniceClass)
+		}
+		//goland:noinspection GoBoolExpressions
+		switch {
+		case runtime.GOOS != "linux":
+			runCfg.outputConfig.addSetupWarning("-ionice-class and -ionice-level are only supported on Linux; ignoring them.")
+		case err != nil:
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -ionice-class: %s", err))
+		case *ioniceLevel < 0 || *ioniceLevel > 7:
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -ionice-level %d: must be between 0 and 7.", *ioniceLevel))
+		default:
+			runCfg.ioPriorityClass = class
+			runCfg.ioPriorityLevel = *ioniceLevel
+			if class == ioPriorityClassIdle {
+				runCfg.ioPriorityLevel = 0
+			}
+		}
+	}
 
 	var runAsConfig *runAsUserConfig
 	//goland:noinspection GoBoolExpressions
@@ -246,33 +782,160 @@ func main() {
 			}
 
 			u, err := user.LookupId(strconv.Itoa(*asUID))
-			if err != nil && u != nil {
+			if err == nil && u.HomeDir != "" {
 				runAsConfig.userHome = u.HomeDir
 			} else if err != nil {
 				runCfg.outputConfig.addSetupWarning(fmt.Sprintf("cannot find homedir for UID %d (%s); HOME will not be changed", *asUID, err))
 			} else {
 				runCfg.outputConfig.addSetupWarning(fmt.Sprintf("cannot find homedir for UID %d; HOME will not be changed", *asUID))
 			}
+
+			var groupIDs []string
+			if *asGroups != "" {
+				groupIDs = strings.Split(*asGroups, ",")
+			} else if err == nil {
+				groupIDs, err = u.GroupIds()
+				if err != nil {
+					runCfg.outputConfig.addSetupWarning(fmt.Sprintf("cannot find supplementary groups for UID %d (%s); the program will have none", *asUID, err))
+				}
+			}
+			for _, groupID := range groupIDs {
+				gid, err := strconv.ParseUint(strings.TrimSpace(groupID), 10, 32)
+				if err != nil {
+					log.Fatalf("Failed to parse supplementary GID '%s' as integer: %s", groupID, err)
+				}
+				runAsConfig.sysProcAttr.Credential.Groups = append(runAsConfig.sysProcAttr.Credential.Groups, uint32(gid))
+			}
 		}
 	}
+	//goland:noinspection GoBoolExpressions
+	if *noNewPrivs && runtime.GOOS != "linux" {
+		runCfg.outputConfig.addSetupWarning("-no-new-privs is only supported on Linux; ignoring it.")
+	} else {
+		runCfg.noNewPrivs = *noNewPrivs
+	}
 	if runAsConfig != nil {
 		runCfg.runAsUser = runAsConfig
+	} else if *asGroups != "" {
+		runCfg.outputConfig.addSetupWarning("Ignoring -groups, which requires -user or -uid.")
+	}
+
+	//goland:noinspection GoBoolExpressions
+	if *chroot != "" && runtime.GOOS == "windows" {
+		runCfg.outputConfig.addSetupWarning("-chroot is not supported on Windows; ignoring it.")
+	} else if *chroot != "" {
+		// a bad -chroot is still used, so the program fails to start rather than running unconfined:
+		runCfg.chroot = *chroot
+		if info, err := os.Stat(*chroot); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to check -chroot, so the program can't be run: %s", err))
+		} else if !info.IsDir() {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("The -chroot '%s' is not a directory, so the program can't be run.", *chroot))
+		} else if !canChroot() {
+			runCfg.outputConfig.addSetupWarning("-chroot requires that runner be run as root or with CAP_SYS_CHROOT, so the program can't be run.")
+		}
+		if runCfg.workDir == "" {
+			// otherwise the program would start in runner's working directory, outside the chroot
+			runCfg.workDir = "/"
+		}
+	}
+
+	if runCfg.workDir != "" {
+		// -work-dir is within the chroot, if any:
+		hostWorkDir := filepath.Join(runCfg.chroot, runCfg.workDir)
+		if *workDirCreate {
+			uid, gid := -1, -1
+			if runAsConfig != nil {
+				uid, gid = runAsConfig.runAsUID, runAsConfig.runAsGID
+			}
+			if err := mkdirAllOwned(hostWorkDir, 0755, uid, gid); err != nil {
+				runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to create -work-dir: %s", err))
+			}
+		} else if info, err := os.Stat(hostWorkDir); os.IsNotExist(err) {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("The -work-dir '%s' doesn't exist, so the program can't be run. (Use -work-dir-create to create it.)", runCfg.workDir))
+		} else if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to check -work-dir: %s", err))
+		} else if !info.IsDir() {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("The -work-dir '%s' is not a directory, so the program can't be run.", runCfg.workDir))
+		}
 	}
 
-	deliveryCfg := &deliveryConfig{}
+	deliveryCfg := &deliveryConfig{
+		transport: &transportConfig{
+			timeout: time.Duration(*deliveryTimeout) * time.Second,
+		},
+	}
+	var tlsCfg *tls.Config
+	if len(caCertFiles) > 0 {
+		caPool, err := loadCACertPool(caCertFiles)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"Failed to load -ca-cert certificates; using system trust store only: %s", err))
+		} else {
+			tlsCfg = &tls.Config{MinVersion: tls.VersionTLS12}
+			tlsCfg.RootCAs = caPool
+		}
+	}
+	if *clientCert != "" || *clientKey != "" {
+		if *clientCert == "" || *clientKey == "" {
+			runCfg.outputConfig.addSetupWarning("-client-cert and -client-key must be given together; no client certificate will be used.")
+		} else if cert, err := tls.LoadX509KeyPair(*clientCert, *clientKey); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"Failed to load client certificate '%s' and key '%s'; no client certificate will be used: %s", *clientCert, *clientKey, err))
+		} else {
+			if tlsCfg == nil {
+				tlsCfg = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+	}
+	deliveryCfg.transport.tlsConfig = tlsCfg
+	for _, spec := range webhookHeaderSpecs {
+		name, value, err := parseWebhookHeader(spec)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -webhook-header: %s", err))
+			continue
+		}
+		if deliveryCfg.transport.headers == nil {
+			deliveryCfg.transport.headers = make(http.Header)
+		}
+		deliveryCfg.transport.headers.Add(name, value)
+	}
 
 	shouldMailOutput := false
 	mailCfg := &mailDeliveryConfig{
-		mailTo:             *mailTo,
 		mailFrom:           *mailFrom,
 		smtpUser:           *smtpUser,
 		smtpPassword:       *smtpPass,
-		smtpHost:           *smtpHost,
 		smtpPort:           *smtpPort,
 		tabCharReplacement: *mailTabCharReplacement,
+		attachJSON:         *mailAttachJSON,
+		attachThreshold:    *mailAttachThreshold,
+		attachGzip:         *mailAttachGzip,
+		html:               *mailHTML,
 	}
-	if mailCfg.mailTo == "" {
-		mailCfg.mailTo = os.Getenv(MailToEnvVar)
+	if *mailTo == "" {
+		*mailTo = os.Getenv(MailToEnvVar)
+	}
+	if *mailCc == "" {
+		*mailCc = os.Getenv(MailCcEnvVar)
+	}
+	if *mailBcc == "" {
+		*mailBcc = os.Getenv(MailBccEnvVar)
+	}
+	for _, addrList := range []struct {
+		flagName string
+		list     string
+		addrs    *[]string
+	}{
+		{"mailto", *mailTo, &mailCfg.mailTo},
+		{"mail-cc", *mailCc, &mailCfg.mailCc},
+		{"mail-bcc", *mailBcc, &mailCfg.mailBcc},
+	} {
+		var invalid []string
+		*addrList.addrs, invalid = splitMailAddresses(addrList.list)
+		for _, addr := range invalid {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -%s address '%s'.", addrList.flagName, addr))
+		}
 	}
 	if mailCfg.mailFrom == "" {
 		mailCfg.mailFrom = os.Getenv(MailFromEnvVar)
@@ -286,12 +949,38 @@ func main() {
 	if mailCfg.smtpPassword == "" {
 		mailCfg.smtpPassword = os.Getenv(SMTPPassEnvVar)
 	}
-	if mailCfg.smtpHost == "" {
-		mailCfg.smtpHost = os.Getenv(SMTPHostEnvVar)
+	if *smtpPassFile == "" {
+		*smtpPassFile = os.Getenv(SMTPPassFileEnvVar)
+	}
+	if mailCfg.smtpPassword == "" && *smtpPassFile != "" {
+		if mailCfg.smtpPassword, err = readSecretFile(*smtpPassFile); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to read -smtp-pass-file: %s", err))
+		}
+	}
+	if *smtpHost == "" {
+		*smtpHost = os.Getenv(SMTPHostEnvVar)
+	}
+	for _, host := range strings.Split(*smtpHost, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			mailCfg.smtpHosts = append(mailCfg.smtpHosts, host)
+		}
 	}
 	if mailCfg.tabCharReplacement == "" {
 		mailCfg.tabCharReplacement = os.Getenv(MailTabCharEnvVar)
 	}
+	if *smtpEncryption == "" {
+		*smtpEncryption = os.Getenv(SMTPEncryptionEnvVar)
+	}
+	mailCfg.smtpEncryption = strings.ToLower(strings.TrimSpace(*smtpEncryption))
+	switch mailCfg.smtpEncryption {
+	case smtpEncryptionAuto, smtpEncryptionNone, smtpEncryptionSSL, smtpEncryptionSTARTTLS:
+	case "":
+		mailCfg.smtpEncryption = smtpEncryptionAuto
+	default:
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+			"Invalid SMTP encryption mode '%s' given; must be one of none, ssl, starttls, or auto. Using auto instead.", mailCfg.smtpEncryption))
+		mailCfg.smtpEncryption = smtpEncryptionAuto
+	}
 	if os.Getenv(SMTPPortEnvVar) != "" && !WasFlagGiven("smtp-port") {
 		smtpPortStr := os.Getenv(SMTPPortEnvVar)
 		mailCfg.smtpPort, err = strconv.Atoi(smtpPortStr)
@@ -299,8 +988,8 @@ func main() {
 			log.Fatalf("Failed to parse %s ('%s') as integer: %s", SMTPPortEnvVar, smtpPortStr, err)
 		}
 	}
-	if mailCfg.mailTo != "" && strings.Contains(mailCfg.mailTo, "@") {
-		if mailCfg.smtpUser != "" && mailCfg.smtpPassword != "" && mailCfg.smtpHost != "" {
+	if len(mailCfg.mailTo) > 0 {
+		if mailCfg.smtpUser != "" && mailCfg.smtpPassword != "" && len(mailCfg.smtpHosts) > 0 {
 			shouldMailOutput = true
 
 			if mailCfg.smtpPort < 1 || mailCfg.smtpPort > 65535 {
@@ -342,6 +1031,14 @@ func main() {
 	if ntfyCfg.ntfyAccessToken == "" {
 		ntfyCfg.ntfyAccessToken = os.Getenv(NtfyAccessTokenEnvVar)
 	}
+	if *ntfyAccessTokenFile == "" {
+		*ntfyAccessTokenFile = os.Getenv(NtfyAccessTokenFileEnvVar)
+	}
+	if ntfyCfg.ntfyAccessToken == "" && *ntfyAccessTokenFile != "" {
+		if ntfyCfg.ntfyAccessToken, err = readSecretFile(*ntfyAccessTokenFile); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to read -ntfy-access-token-file: %s", err))
+		}
+	}
 	if os.Getenv(NtfyPriorityEnvVar) != "" && !WasFlagGiven("ntfy-priority") {
 		ntfyPriorityStr := os.Getenv(NtfyPriorityEnvVar)
 		ntfyCfg.ntfyPriority, err = strconv.Atoi(ntfyPriorityStr)
@@ -366,6 +1063,28 @@ func main() {
 			))
 		}
 	}
+	if *ntfyClick == "" {
+		*ntfyClick = os.Getenv(NtfyClickEnvVar)
+	}
+	if *ntfyClick != "" {
+		if clickURL, err := url.Parse(*ntfyClick); err != nil || !clickURL.IsAbs() {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -ntfy-click URL '%s'; it must be an absolute URL.", *ntfyClick))
+		} else {
+			ntfyCfg.ntfyClickURL = clickURL
+		}
+	}
+	for _, spec := range ntfyActionSpecs {
+		action, err := parseNtfyAction(spec)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -ntfy-action: %s", err))
+			continue
+		}
+		if len(ntfyCfg.ntfyActions) == ntfyMaxActions {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("ntfy allows at most %d action buttons; ignoring -ntfy-action '%s'.", ntfyMaxActions, spec))
+			continue
+		}
+		ntfyCfg.ntfyActions = append(ntfyCfg.ntfyActions, action)
+	}
 	if ntfyCfg.ntfyPriority < 1 || ntfyCfg.ntfyPriority > 5 {
 		runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
 			"Invalid ntfy priority %d given; must be between 1-5, inclusive.", ntfyCfg.ntfyPriority))
@@ -377,10 +1096,25 @@ func main() {
 
 	discordCfg := &discordDeliveryConfig{
 		discordWebhookURL: *discordHookURL,
+		discordUsername:   *discordUsername,
+		discordAvatarURL:  *discordAvatarURL,
+	}
+	if *discordContent != "" {
+		if discordCfg.discordContent, err = template.New("discord-content").Parse(*discordContent); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -discord-content: %s", err))
+		}
 	}
 	if discordCfg.discordWebhookURL == "" {
 		discordCfg.discordWebhookURL = os.Getenv(DiscordWebhookEnvVar)
 	}
+	if *discordHookURLFile == "" {
+		*discordHookURLFile = os.Getenv(DiscordWebhookFileEnvVar)
+	}
+	if discordCfg.discordWebhookURL == "" && *discordHookURLFile != "" {
+		if discordCfg.discordWebhookURL, err = readSecretFile(*discordHookURLFile); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to read -discord-webhook-file: %s", err))
+		}
+	}
 	if discordCfg.discordWebhookURL != "" {
 		if !strings.HasPrefix(strings.ToLower(discordCfg.discordWebhookURL), "http") {
 			discordCfg.discordWebhookURL = "https://" + discordCfg.discordWebhookURL
@@ -388,61 +1122,681 @@ func main() {
 		deliveryCfg.discord = discordCfg
 	}
 
-	if *successNotifyURL == "" {
-		*successNotifyURL = os.Getenv(SuccessNotifyEnvVar)
+	zulipCfg := &zulipDeliveryConfig{
+		zulipSiteURL: *zulipSite,
+		zulipEmail:   *zulipEmail,
+		zulipAPIKey:  *zulipAPIKey,
+		zulipStream:  *zulipStream,
+		zulipTopic:   *zulipTopic,
+	}
+	if zulipCfg.zulipSiteURL == "" {
+		zulipCfg.zulipSiteURL = os.Getenv(ZulipSiteEnvVar)
+	}
+	if zulipCfg.zulipEmail == "" {
+		zulipCfg.zulipEmail = os.Getenv(ZulipEmailEnvVar)
+	}
+	if zulipCfg.zulipAPIKey == "" {
+		zulipCfg.zulipAPIKey = os.Getenv(ZulipAPIKeyEnvVar)
+	}
+	if zulipCfg.zulipStream == "" {
+		zulipCfg.zulipStream = os.Getenv(ZulipStreamEnvVar)
+	}
+	if zulipCfg.zulipTopic == "" {
+		zulipCfg.zulipTopic = os.Getenv(ZulipTopicEnvVar)
+	}
+	if zulipCfg.zulipTopic == "" {
+		zulipCfg.zulipTopic = runCfg.outputConfig.jobName
+	}
+	if zulipCfg.zulipSiteURL != "" {
+		if !strings.HasPrefix(strings.ToLower(zulipCfg.zulipSiteURL), "http") {
+			zulipCfg.zulipSiteURL = "https://" + zulipCfg.zulipSiteURL
+		}
+		if zulipCfg.zulipEmail != "" && zulipCfg.zulipAPIKey != "" && zulipCfg.zulipStream != "" {
+			deliveryCfg.zulip = zulipCfg
+		} else {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"If using -zulip-site (or the %s env var), you must also specify -zulip-email (%s), -zulip-api-key (%s), -zulip-stream (%s).",
+				ZulipSiteEnvVar, ZulipEmailEnvVar, ZulipAPIKeyEnvVar, ZulipStreamEnvVar,
+			))
+		}
+	}
+
+	whatsAppCfg := &whatsAppDeliveryConfig{
+		whatsAppGatewayURL: *whatsAppURL,
+		whatsAppToken:      *whatsAppToken,
+		whatsAppTo:         *whatsAppTo,
+	}
+	if whatsAppCfg.whatsAppGatewayURL == "" {
+		whatsAppCfg.whatsAppGatewayURL = os.Getenv(WhatsAppURLEnvVar)
+	}
+	if whatsAppCfg.whatsAppToken == "" {
+		whatsAppCfg.whatsAppToken = os.Getenv(WhatsAppTokenEnvVar)
+	}
+	if whatsAppCfg.whatsAppTo == "" {
+		whatsAppCfg.whatsAppTo = os.Getenv(WhatsAppToEnvVar)
+	}
+	if whatsAppCfg.whatsAppGatewayURL != "" {
+		if !strings.HasPrefix(strings.ToLower(whatsAppCfg.whatsAppGatewayURL), "http") {
+			whatsAppCfg.whatsAppGatewayURL = "https://" + whatsAppCfg.whatsAppGatewayURL
+		}
+		if whatsAppCfg.whatsAppTo != "" {
+			deliveryCfg.whatsApp = whatsAppCfg
+		} else {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"If using -whatsapp-url (or the %s env var), you must also specify -whatsapp-to (%s).",
+				WhatsAppURLEnvVar, WhatsAppToEnvVar,
+			))
+		}
+	}
+
+	gotifyCfg := &gotifyDeliveryConfig{
+		gotifyServerURL: *gotifyServer,
+		gotifyToken:     *gotifyToken,
+		gotifyPriority:  -1,
+	}
+	if gotifyCfg.gotifyServerURL == "" {
+		gotifyCfg.gotifyServerURL = os.Getenv(GotifyServerEnvVar)
+	}
+	if gotifyCfg.gotifyToken == "" {
+		gotifyCfg.gotifyToken = os.Getenv(GotifyTokenEnvVar)
+	}
+	if WasFlagGiven("gotify-priority") {
+		gotifyCfg.gotifyPriority = *gotifyPriority
+	} else if os.Getenv(GotifyPriorityEnvVar) != "" {
+		gotifyPriorityStr := os.Getenv(GotifyPriorityEnvVar)
+		gotifyCfg.gotifyPriority, err = strconv.Atoi(gotifyPriorityStr)
+		if err != nil {
+			log.Fatalf("Failed to parse the given %s ('%s') as integer: %s", GotifyPriorityEnvVar, gotifyPriorityStr, err)
+		}
+	}
+	if gotifyPriorityGiven := WasFlagGiven("gotify-priority") || os.Getenv(GotifyPriorityEnvVar) != ""; gotifyPriorityGiven &&
+		(gotifyCfg.gotifyPriority < 0 || gotifyCfg.gotifyPriority > 10) {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+			"Invalid Gotify priority %d given; must be between 0-10, inclusive.", gotifyCfg.gotifyPriority))
+		gotifyCfg.gotifyPriority = -1
+	}
+	if gotifyCfg.gotifyServerURL != "" {
+		if !strings.HasPrefix(strings.ToLower(gotifyCfg.gotifyServerURL), "http") {
+			gotifyCfg.gotifyServerURL = "https://" + gotifyCfg.gotifyServerURL
+		}
+		if gotifyCfg.gotifyToken != "" {
+			deliveryCfg.gotify = gotifyCfg
+		} else {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"If using -gotify-server (or the %s env var), you must also specify -gotify-token (%s).",
+				GotifyServerEnvVar, GotifyTokenEnvVar,
+			))
+		}
+	}
+
+	matrixCfg := &matrixDeliveryConfig{
+		matrixHomeserverURL: *matrixHomeserver,
+		matrixToken:         *matrixToken,
+		matrixRoomID:        *matrixRoomID,
+	}
+	if matrixCfg.matrixHomeserverURL == "" {
+		matrixCfg.matrixHomeserverURL = os.Getenv(MatrixHomeserverEnvVar)
+	}
+	if matrixCfg.matrixToken == "" {
+		matrixCfg.matrixToken = os.Getenv(MatrixTokenEnvVar)
+	}
+	if matrixCfg.matrixRoomID == "" {
+		matrixCfg.matrixRoomID = os.Getenv(MatrixRoomIDEnvVar)
+	}
+	if matrixCfg.matrixHomeserverURL != "" {
+		if !strings.HasPrefix(strings.ToLower(matrixCfg.matrixHomeserverURL), "http") {
+			matrixCfg.matrixHomeserverURL = "https://" + matrixCfg.matrixHomeserverURL
+		}
+		if matrixCfg.matrixToken != "" && matrixCfg.matrixRoomID != "" {
+			deliveryCfg.matrix = matrixCfg
+		} else {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"If using -matrix-homeserver (or the %s env var), you must also specify -matrix-token (%s), -matrix-room-id (%s).",
+				MatrixHomeserverEnvVar, MatrixTokenEnvVar, MatrixRoomIDEnvVar,
+			))
+		}
+	}
+
+	if *pagerdutyRoutingKey == "" {
+		*pagerdutyRoutingKey = os.Getenv(PagerDutyRoutingKeyEnvVar)
+	}
+	if *pagerdutyRoutingKey != "" {
+		deliveryCfg.pagerduty = &pagerdutyDeliveryConfig{
+			pagerdutyRoutingKey:  *pagerdutyRoutingKey,
+			pagerdutyAutoResolve: *pagerdutyAutoResolve,
+		}
+	} else if *pagerdutyAutoResolve {
+		runCfg.outputConfig.addSetupWarning("-pagerduty-auto-resolve has no effect without -pagerduty-routing-key.")
+	}
+
+	if *snsTopicARN == "" {
+		*snsTopicARN = os.Getenv(SNSTopicARNEnvVar)
+	}
+	if *snsRegion == "" {
+		*snsRegion = os.Getenv(SNSRegionEnvVar)
+	}
+	if *snsTopicARN != "" {
+		// ARNs have the form arn:PARTITION:sns:REGION:ACCOUNT:TOPIC
+		arnParts := strings.Split(*snsTopicARN, ":")
+		if len(arnParts) != 6 || arnParts[0] != "arn" || arnParts[2] != "sns" {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Invalid SNS topic ARN '%s' given; it must have the form arn:aws:sns:REGION:ACCOUNT:TOPIC.", *snsTopicARN))
+		} else {
+			if *snsRegion == "" {
+				*snsRegion = arnParts[3]
+			}
+			deliveryCfg.sns = &snsDeliveryConfig{snsTopicARN: *snsTopicARN, snsRegion: *snsRegion}
+		}
+	}
+
+	if *webhookURL == "" {
+		*webhookURL = os.Getenv(WebhookURLEnvVar)
+	}
+	if *webhookURL != "" {
+		if !strings.HasPrefix(strings.ToLower(*webhookURL), "http") {
+			*webhookURL = "https://" + *webhookURL
+		}
+		deliveryCfg.webhook = &webhookDeliveryConfig{webhookURL: *webhookURL}
+		for _, spec := range webhookURLHeaderSpecs {
+			name, value, err := parseWebhookHeader(spec)
+			if err != nil {
+				runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -webhook-url-header: %s", err))
+				continue
+			}
+			if deliveryCfg.webhook.webhookHeaders == nil {
+				deliveryCfg.webhook.webhookHeaders = make(http.Header)
+			}
+			deliveryCfg.webhook.webhookHeaders.Add(name, value)
+		}
+	} else if len(webhookURLHeaderSpecs) > 0 {
+		runCfg.outputConfig.addSetupWarning("Ignoring -webhook-url-header, which requires -webhook-url.")
+	}
+
+	if *successURL == "" {
+		*successURL = *successNotifyURL
+	}
+	if *successURL == "" {
+		*successURL = os.Getenv(SuccessURLEnvVar)
+	}
+	if *successURL == "" {
+		*successURL = os.Getenv(SuccessNotifyEnvVar)
+	}
+	if *failureURL == "" {
+		*failureURL = os.Getenv(FailureURLEnvVar)
+	}
+	if *healthcheckURL == "" {
+		*healthcheckURL = os.Getenv(HealthcheckEnvVar)
+	}
+
+	throttles := make(map[string]time.Duration)
+	for _, spec := range throttleSpecs {
+		channel, interval, err := parseThrottle(spec)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -throttle: %s", err))
+			continue
+		}
+		throttles[channel] = interval
+	}
+
+	switch *notifyOn = strings.ToLower(*notifyOn); *notifyOn {
+	case notifyOnFailure, notifyOnSuccess, notifyOnAlways:
+	case notifyOnChange:
+		*notifyOnTransition = true
+	default:
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring unknown -notify-on '%s'; using %s.", *notifyOn, notifyOnFailure))
+		*notifyOn = notifyOnFailure
+	}
+
+	// Job state is only loaded and saved if a feature requires it:
+	var jobStatePath string
+	var state *jobState
+	usesJobState := len(throttles) > 0 || *durationHistory > 0 || *notifyOnTransition || *minConsecutiveFailures > 0 || *notifyCooldown > 0
+	if usesJobState || (*singleInstance && *lockFile == "") {
+		if *stateDir == "" {
+			*stateDir = os.Getenv(StateDirEnvVar)
+		}
+		if *stateDir == "" {
+			*stateDir, err = defaultStateDir()
+			if err != nil {
+				runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+					"Failed to determine a default state directory (%s); use -state-dir. Job state will not be persisted.", err))
+			}
+		}
+		if *stateDir != "" && *singleInstance && *lockFile == "" {
+			*lockFile = lockFilePath(*stateDir, runCfg.outputConfig.jobName)
+		}
+		if *stateDir != "" && usesJobState {
+			jobStatePath = stateFilePath(*stateDir, runCfg.outputConfig.jobName)
+			state, err = loadJobState(jobStatePath)
+			if err != nil {
+				runCfg.outputConfig.addSetupWarning(fmt.Sprintf("%s; starting with empty job state.", err))
+			}
+		}
+	}
+	if state == nil {
+		state = &jobState{}
+	}
+	if *durationHistory > 0 {
+		runCfg.outputConfig.recentDurations = state.recentDurations(*durationHistory)
+	}
+
+	var dedupCfg *dedupConfig
+	if *dedupDir == "" {
+		*dedupDir = os.Getenv(DedupDirEnvVar)
+	}
+	if *dedupDir != "" {
+		if *dedupWindow > 0 {
+			dedupCfg = &dedupConfig{
+				dedupDir: *dedupDir,
+				window:   time.Duration(*dedupWindow) * time.Second,
+				hostname: hostname,
+			}
+		} else {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf(
+				"Invalid -dedup-window %d given; must be positive. Alerts will not be deduplicated.", *dedupWindow))
+		}
+	}
+
+	var spoolCfg *spoolConfig
+	if *spoolDir == "" {
+		*spoolDir = os.Getenv(SpoolDirEnvVar)
+	}
+	if *spoolDir != "" {
+		spoolCfg = &spoolConfig{
+			spoolDir: *spoolDir,
+			maxAge:   *spoolMaxAge,
+		}
 	}
 
 	logCfg := &logConfig{
-		logDir:   *logDir,
-		runAsUID: -1,
-		runAsGID: -1,
+		logDir:                *logDir,
+		logRoot:               *logRoot,
+		runAsUID:              -1,
+		runAsGID:              -1,
+		includeDeliveryStatus: *logDeliveryLatency,
+		jsonHeader:            *logJSONHeader,
+		omitProgramOutput:     *logOmitOutput,
+		format:                strings.ToLower(*logFormat),
+		keepDays:              *logKeepDays,
+		keepCount:             *logKeepCount,
+	}
+	if logCfg.format != logFormatText && logCfg.format != logFormatJSON {
+		runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring unknown -log-format '%s'; using %s.", *logFormat, logFormatText))
+		logCfg.format = logFormatText
+	}
+	if *logExt = removeBadFilenameChars(strings.TrimPrefix(*logExt, ".")); *logExt == "" {
+		*logExt = "log"
+	}
+	var logNameTmpl *template.Template
+	if *logNameTemplate != "" {
+		logNameTmpl, err = template.New("log-name-template").Parse(*logNameTemplate)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -log-name-template: %s", err))
+		}
+	}
+	var outputPrefixTmpl, outputSuffixTmpl *template.Template
+	if *outputPrefix != "" {
+		outputPrefixTmpl, err = template.New("output-prefix").Parse(*outputPrefix)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -output-prefix: %s", err))
+		}
+	}
+	if *outputSuffix != "" {
+		outputSuffixTmpl, err = template.New("output-suffix").Parse(*outputSuffix)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Ignoring invalid -output-suffix: %s", err))
+		}
 	}
 	if logCfg.logDir == "" {
 		logCfg.logDir = os.Getenv(LogDirEnvVar)
 	}
+	if logCfg.logDir == "" && *logDefaultDir {
+		logCfg.logDir, err = defaultLogDir(runAsConfig)
+		if err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Failed to determine a default log directory; logs will not be written: %s", err))
+		}
+	}
 	if runAsConfig != nil {
 		logCfg.runAsUID = runAsConfig.runAsUID
 		logCfg.runAsGID = runAsConfig.runAsGID
 	}
 
+	var syslogCfg *syslogConfig
+	//goland:noinspection GoBoolExpressions
+	if *useSyslog && runtime.GOOS == "windows" {
+		runCfg.outputConfig.addSetupWarning("-syslog is not supported on Windows; ignoring it.")
+	} else if *useSyslog {
+		syslogCfg = &syslogConfig{tag: *syslogTag, facility: strings.ToLower(*syslogFacility)}
+		if !isSyslogFacility(syslogCfg.facility) {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Unknown -syslog-facility '%s'; using '%s'.", *syslogFacility, defaultSyslogFacility))
+			syslogCfg.facility = defaultSyslogFacility
+		}
+	}
+
 	// Configuration is (finally) complete!
 	// Run the program, print+deliver output if necessary, and write log file[s].
 
+	if *testDelivery {
+		if !reportTestDeliveries(runCfg, executeDeliveries(deliveryCfg, testRunOutput(runCfg, time.Now()), nil)) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *trapPanics {
+		defer handlePanic(deliveryCfg, logCfg, hostname, runCfg.outputConfig.jobName, runCfg.outputConfig.noEmoji)
+	}
+
+	if *singleInstance && *lockFile == "" {
+		log.Fatalf("-single-instance requires a state directory; use -state-dir.")
+	}
+	if *lockFile != "" {
+		// The lock is held until runner is done; if runner exits early (or is killed),
+		// the OS releases it.
+		lock, err := acquireLock(*lockFile, time.Duration(*lockWait)*time.Second)
+		if err != nil {
+			log.Fatalf("Failed to acquire lock: %s", err)
+		}
+		if lock == nil {
+			// another instance of the job is running:
+			os.Exit(0)
+		}
+		defer lock.Close()
+	}
+
+	if *preRun != "" {
+		runCfg.preRunResult = runPreRun(runCfg, *preRun)
+		if !runCfg.preRunResult.passed && !*preRunRequired {
+			// the program's precondition isn't met; skip this run:
+			os.Exit(0)
+		}
+	} else if *preRunRequired {
+		runCfg.outputConfig.addSetupWarning("Ignoring -pre-run-required, which requires -pre-run.")
+	}
+
+	var deliveryErrs []error
+	if spoolCfg != nil {
+		deliveryErrs = append(deliveryErrs, flushSpool(spoolCfg, deliveryCfg)...)
+	}
+	if *notifyOnStart {
+		startChannels := allChannels()
+		if *notifyOnStartChannels != "" {
+			startChannels, err = parseChannelList(*notifyOnStartChannels)
+			if err != nil {
+				runCfg.outputConfig.addSetupWarning(fmt.Sprintf("Invalid -notify-on-start-channels: %s; not sending a start notification.", err))
+			}
+		}
+		startCfg := deliveryCfg.onlyChannels(startChannels)
+		startOut := startRunOutput(runCfg, time.Now())
+		if startCfg.discord != nil {
+			startCfg.discord.logFileName = fmt.Sprintf("%s.%s.start.txt",
+				removeBadFilenameChars(startOut.jobName),
+				startOut.startTime.Format("2006-01-02T15-04-05.000-0700"),
+			)
+		}
+		for _, err := range deliveryErrors(executeDeliveries(startCfg, startOut, nil)) {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("start notification: %w", err))
+		}
+	}
+
+	var liveLogFile *os.File
+	var liveLogRedactor *redactingWriter
+	if *liveLog {
+		if logCfg.logDir == "" {
+			runCfg.outputConfig.addSetupWarning("-live-log requires a log directory (see -log-dir); output will not be logged while the program runs.")
+		} else if liveLogFile, err = openLiveLog(logCfg, runCfg.outputConfig.jobName, time.Now()); err != nil {
+			runCfg.outputConfig.addSetupWarning(fmt.Sprintf("%s; output will not be logged while the program runs.", err))
+		} else {
+			// the program's output is written as it runs, so it's redacted as it's written:
+			liveLogRedactor = newRedactingWriter(liveLogFile, censoredValues(buildChildEnv(runCfg)))
+			runCfg.liveOutput = liveLogRedactor
+		}
+	}
+
+	if *healthcheckURL != "" {
+		if err := pingHealthcheck(*healthcheckURL, "/start", "", deliveryCfg.transport); err != nil {
+			deliveryErrs = append(deliveryErrs, err)
+		}
+	}
+
 	runOut := runner(runCfg)
+	if liveLogFile != nil {
+		_ = liveLogRedactor.Flush()
+		_ = liveLogFile.Close()
+	}
+	if *durationHistory > 0 && runOut.succeeded {
+		state.recordDuration(runOut.endTime.Sub(runOut.startTime), *durationHistory)
+	}
 
-	logFileName := fmt.Sprintf("%s.%s.log",
-		removeBadFilenameChars(runOut.jobName),
+	logFilePrefix := removeBadFilenameChars(runOut.jobName)
+	if *logNameStatus {
+		logFilePrefix += "." + logNameStatusTag(runOut)
+	}
+	logFileName := fmt.Sprintf("%s.%s.%s",
+		logFilePrefix,
 		runOut.startTime.Format("2006-01-02T15-04-05.000-0700"),
+		*logExt,
 	)
+	if logNameTmpl != nil {
+		if name, err := logFileNameFromTemplate(logNameTmpl, runOut); err != nil {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to apply -log-name-template (using '%s' instead): %w", logFileName, err))
+		} else {
+			logFileName = name
+		}
+	}
+	if deliveryCfg.mail != nil {
+		deliveryCfg.mail.logFileName = filepath.Base(logFileName)
+	}
 	if deliveryCfg.discord != nil {
-		deliveryCfg.discord.logFileName = logFileName
+		deliveryCfg.discord.logFileName = filepath.Base(logFileName)
 	}
 	logCfg.logFileName = logFileName
 
-	var deliveryErrs []error
+	var deliveryResults []deliveryResult
+
+	// Normally, output is delivered whenever it's printed; -notify-on can change that.
+	// In -notify-on-transition mode, output is delivered only when the run's status
+	// differs from the previous run's.
+	shouldDeliver := runOut.shouldPrint
+	switch *notifyOn {
+	case notifyOnSuccess:
+		shouldDeliver = runOut.succeeded
+	case notifyOnAlways:
+		shouldDeliver = true
+	}
+	runDuration := runOut.endTime.Sub(runOut.startTime)
+	ranLong := *notifyMaxDuration > 0 && runOut.succeeded && runDuration > time.Duration(*notifyMaxDuration)*time.Second
+	if ranLong {
+		shouldDeliver = true
+	}
+	if *notifyOnTransition && state.LastStatus != "" {
+		if state.LastStatus == runOut.status && !ranLong {
+			if shouldDeliver {
+				deliveryResults = skipDeliveries(deliveryCfg, fmt.Sprintf("status unchanged since last run (%s)", state.LastStatus))
+			}
+			shouldDeliver = false
+		} else {
+			shouldDeliver = true
+		}
+	}
+	previousStatus := state.LastStatus
+	state.LastStatus = runOut.status
+
+	if runOut.succeeded {
+		state.ConsecutiveFailures = 0
+	} else {
+		state.ConsecutiveFailures++
+	}
+	if shouldDeliver && !runOut.succeeded && runDuration < time.Duration(*notifyMinDuration)*time.Second {
+		deliveryResults = skipDeliveries(deliveryCfg, fmt.Sprintf("failed after only %s, less than -notify-min-duration", runDuration.Round(time.Millisecond)))
+		shouldDeliver = false
+	}
+	if shouldDeliver && !runOut.succeeded && state.ConsecutiveFailures < *minConsecutiveFailures {
+		deliveryResults = skipDeliveries(deliveryCfg, fmt.Sprintf("failure #%d of %d required by -min-consecutive-failures", state.ConsecutiveFailures, *minConsecutiveFailures))
+		shouldDeliver = false
+	}
 
-	if runOut.shouldPrint {
-		deliveryErrs = executeDeliveries(deliveryCfg, runOut)
+	if shouldDeliver && *notifyCooldown > 0 && !state.LastNotified.IsZero() && time.Since(state.LastNotified) < *notifyCooldown {
+		deliveryResults = skipDeliveries(deliveryCfg, fmt.Sprintf("within -notify-cooldown of the last notification, at %s", state.LastNotified.Format(time.RFC3339)))
+		state.SuppressedNotifications++
+		shouldDeliver = false
+	}
 
+	if shouldDeliver {
+		if dedupCfg != nil && len(deliveryCfg.channels()) > 0 {
+			claimed, suppressReason, err := claimAlert(dedupCfg, runOut.jobName)
+			if err != nil {
+				deliveryErrs = append(deliveryErrs, fmt.Errorf("alert deduplication failed; delivering anyway: %w", err))
+			}
+			if !claimed {
+				shouldDeliver = false
+				deliveryResults = skipDeliveries(deliveryCfg, suppressReason)
+			}
+		}
+		if shouldDeliver {
+			deliveryTime := time.Now()
+			deliveryOut := runOut
+			if *minConsecutiveFailures > 0 && !runOut.succeeded {
+				streakOut := *deliveryOut
+				streakOut.summaryLine = fmt.Sprintf("%s (failure #%d)", deliveryOut.summaryLine, state.ConsecutiveFailures)
+				deliveryOut = &streakOut
+			}
+			if *notifyCooldown > 0 && state.SuppressedNotifications > 0 {
+				cooldownOut := *deliveryOut
+				cooldownOut.summaryLine = fmt.Sprintf("%s (%d notification(s) suppressed by -notify-cooldown)", deliveryOut.summaryLine, state.SuppressedNotifications)
+				deliveryOut = &cooldownOut
+			}
+			if ranLong {
+				longOut := *deliveryOut
+				longOut.summaryLine = fmt.Sprintf("%s (ran longer than %s)", deliveryOut.summaryLine, time.Duration(*notifyMaxDuration)*time.Second)
+				deliveryOut = &longOut
+			}
+			if outputPrefixTmpl != nil || outputSuffixTmpl != nil {
+				wrappedOut, err := wrapOutput(outputPrefixTmpl, outputSuffixTmpl, deliveryOut)
+				if err != nil {
+					deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to apply -output-prefix/-output-suffix (delivering output without them): %w", err))
+				}
+				deliveryOut = wrappedOut
+			}
+			if *notifyTitleFromOutput && runOut.firstLine != "" {
+				titledOut := *deliveryOut
+				titledOut.summaryLine = fmt.Sprintf("%s: %s", deliveryOut.summaryLine, truncateString(runOut.firstLine, maxTitleLineLength))
+				deliveryOut = &titledOut
+			}
+			deliveryResults = executeDeliveries(deliveryCfg, deliveryOut, throttledChannels(throttles, state, deliveryTime))
+			deliveryErrs = append(deliveryErrs, deliveryErrors(deliveryResults)...)
+			if spoolCfg != nil {
+				deliveryErrs = append(deliveryErrs, spoolFailedDeliveries(spoolCfg, deliveryOut, filepath.Base(logFileName), deliveryResults)...)
+			}
+			for _, r := range deliveryResults {
+				if r.err == nil && r.skipReason == "" {
+					state.recordDelivery(r.channel, deliveryTime)
+					state.LastNotified = deliveryTime
+					state.SuppressedNotifications = 0
+				}
+			}
+		}
+	}
+
+	printOutput := runOut.shouldPrint || *tee
+	if printOutput {
 		to := os.Stdout
 		if *printToStderr {
 			to = os.Stderr
 		}
-		_, err := fmt.Fprint(to, runOut.output)
+		printed := runOut.output
+		if *quiet {
+			printed = strings.TrimPrefix(strings.TrimPrefix(printed, runOut.header), programOutputHeading)
+		}
+		_, err := fmt.Fprint(to, printed)
 		if err != nil {
 			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to print output: %w", err))
 		}
 	}
 
-	if runOut.succeeded && *successNotifyURL != "" {
-		if err := deliverSuccessNotification(*successNotifyURL); err != nil {
+	// The full output begins with the summary line, so only print it separately
+	// if the full output didn't just go to stdout:
+	if *printSummaryLine && (!printOutput || *printToStderr || *quiet) {
+		if _, err := fmt.Fprintln(os.Stdout, runOut.summaryLine); err != nil {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to print summary line: %w", err))
+		}
+	}
+
+	if runOut.succeeded && *successURL != "" {
+		if err := deliverStatusNotification(statusURL(*successURL, runOut), deliveryCfg.transport); err != nil {
 			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to call success notification URL: %w", err))
 		}
 	}
+	if !runOut.succeeded && *failureURL != "" {
+		if err := deliverStatusNotification(statusURL(*failureURL, runOut), deliveryCfg.transport); err != nil {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to call failure notification URL: %w", err))
+		}
+	}
+	// A success resolves the incident opened by a previous failure (if the previous run's
+	// status is unknown, resolve anyway; PagerDuty ignores resolve events for closed incidents):
+	if deliveryCfg.pagerduty != nil && deliveryCfg.pagerduty.pagerdutyAutoResolve &&
+		runOut.succeeded && !runOut.partial && previousStatus != statusSucceeded {
+		if err := resolvePagerdutyIncident(deliveryCfg.pagerduty, deliveryCfg.transport, runOut); err != nil {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to resolve PagerDuty incident: %w", err))
+		}
+	}
+	if *healthcheckURL != "" {
+		suffix, body := "", ""
+		if !runOut.succeeded {
+			suffix, body = "/fail", runOut.output
+		}
+		if err := pingHealthcheck(*healthcheckURL, suffix, body, deliveryCfg.transport); err != nil {
+			deliveryErrs = append(deliveryErrs, err)
+		}
+	}
+
+	if runOut.succeeded && *successFile != "" {
+		if err := touchFile(*successFile, logCfg.runAsUID, logCfg.runAsGID); err != nil {
+			deliveryErrs = append(deliveryErrs, fmt.Errorf("failed to touch -success-file: %w", err))
+		}
+	}
+
+	if syslogCfg != nil {
+		if err := writeSyslog(syslogCfg, runOut); err != nil {
+			deliveryErrs = append(deliveryErrs, err)
+		}
+	}
+
+	if *metricsFile != "" {
+		if err := writeMetricsFile(*metricsFile, runOut); err != nil {
+			deliveryErrs = append(deliveryErrs, err)
+		}
+	}
 
-	err = writeLogs(logCfg, runOut, deliveryErrs)
+	if jobStatePath != "" {
+		if err := saveJobState(jobStatePath, state); err != nil {
+			deliveryErrs = append(deliveryErrs, err)
+		}
+	}
+
+	err = writeLogs(logCfg, runOut, deliveryResults, deliveryErrs)
+	if err == nil && liveLogFile != nil && runCfg.maxOutputBytes == 0 {
+		// the run's log includes everything in the live log (unless output was capped):
+		_ = os.Remove(liveLogFile.Name())
+	}
+	if err == nil {
+		if pruneErr := pruneLogs(logCfg, runOut.jobName, time.Now()); pruneErr != nil {
+			log.Printf("Failed to prune old logs: %s", pruneErr)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to write logs: %s", err)
+		if *logErrorsNonfatal {
+			log.Printf("Failed to write logs: %s", err)
+		} else {
+			log.Fatalf("Failed to write logs: %s", err)
+		}
+	}
+
+	if *propagateExit {
+		if runOut.exitCode >= 0 {
+			os.Exit(runOut.exitCode)
+		}
+		// the program didn't run, or was killed by a signal:
+		os.Exit(1)
 	}
 }
 
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// metricsFilePerm allows node_exporter's textfile collector, which may run as another user,
+// to read the metrics file.
+const metricsFilePerm = 0644
+
+const metricLastSuccessTimestamp = "runner_last_success_timestamp"
+
+// writeMetricsFile atomically writes the run's metrics, in Prometheus' text format, to the
+// given path (e.g. for node_exporter's textfile collector). The last success timestamp is
+// carried over from the existing file if this run failed.
+func writeMetricsFile(path string, runOut *runOutput) error {
+	lastSuccess := ""
+	if runOut.succeeded {
+		lastSuccess = strconv.FormatInt(runOut.endTime.Unix(), 10)
+	} else {
+		lastSuccess = previousMetricValue(path, metricLastSuccessTimestamp)
+	}
+
+	labels := fmt.Sprintf(`{job_name="%s"}`, escapeMetricLabelValue(runOut.jobName))
+	content := strings.Builder{}
+	writeMetric := func(name, help, value string) {
+		content.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n%s%s %s\n", name, help, name, name, labels, value))
+	}
+	if lastSuccess != "" {
+		writeMetric(metricLastSuccessTimestamp, "Unix time at which the job last succeeded.", lastSuccess)
+	}
+	writeMetric("runner_last_run_timestamp", "Unix time at which the job's last run finished.",
+		strconv.FormatInt(runOut.endTime.Unix(), 10))
+	writeMetric("runner_last_exit_code", "Exit code of the job's last run.",
+		strconv.Itoa(runOut.exitCode))
+	writeMetric("runner_last_duration_seconds", "Duration of the job's last run, in seconds.",
+		strconv.FormatFloat(runOut.endTime.Sub(runOut.startTime).Seconds(), 'f', 3, 64))
+
+	// the collector ignores files without the .prom extension, so use a different one while writing:
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary metrics file: %w", err)
+	}
+	_, err = tmpFile.WriteString(content.String())
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), metricsFilePerm)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return fmt.Errorf("failed to write metrics file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// previousMetricValue returns the value of the given metric in the given metrics file, or ""
+// if it can't be read.
+func previousMetricValue(path, name string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+"{") && !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		value := fields[len(fields)-1]
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// escapeMetricLabelValue escapes the given string for use as a Prometheus label value.
+func escapeMetricLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+// setNiceness sets the scheduling priority ("niceness") of the given process.
+func setNiceness(pid, niceness int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, niceness)
+}
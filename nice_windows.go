@@ -0,0 +1,6 @@
+package main
+
+func setNiceness(_, _ int) error {
+	// no-op on Windows
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+const prSetNoNewPrivs = 38 // PR_SET_NO_NEW_PRIVS, from linux/prctl.h
+
+// startCommand starts the given command. If config.noNewPrivs is set, the command is started
+// with the no_new_privs attribute, so neither it nor its descendants can gain privileges
+// (e.g. via setuid binaries or file capabilities).
+func startCommand(cmd *exec.Cmd, config *runConfig) error {
+	if !config.noNewPrivs {
+		return cmd.Start()
+	}
+
+	// no_new_privs is a per-thread attribute, inherited by processes the thread forks, and
+	// can't be unset. So set it on a dedicated OS thread which starts the command, and which
+	// is discarded (rather than returned to the Go runtime) once that goroutine exits.
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		// the thread is deliberately never unlocked
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+			result <- errno
+			return
+		}
+		result <- cmd.Start()
+	}()
+	return <-result
+}
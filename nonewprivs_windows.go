@@ -0,0 +1,8 @@
+package main
+
+import "os/exec"
+
+// startCommand starts the given command. config.noNewPrivs is only supported on Linux.
+func startCommand(cmd *exec.Cmd, _ *runConfig) error {
+	return cmd.Start()
+}
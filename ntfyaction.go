@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cdzombak/gotfy"
+)
+
+// ntfyMaxActions is the maximum number of action buttons ntfy allows per notification.
+const ntfyMaxActions = 3
+
+// ntfyHTTPAction is an ntfy "http" action button. (gotfy.HttpAction doesn't marshal its
+// URL correctly.)
+type ntfyHTTPAction struct {
+	label  string
+	url    *url.URL
+	method string
+	clear  bool
+}
+
+func (a *ntfyHTTPAction) ButtonType() gotfy.ActionButtonType {
+	return gotfy.ActionButtonTypeHTTP
+}
+
+func (a *ntfyHTTPAction) MarshalJSON() ([]byte, error) {
+	m := map[string]any{
+		"action": "http",
+		"label":  a.label,
+		"url":    a.url.String(),
+	}
+	if a.method != "" {
+		m["method"] = a.method
+	}
+	if a.clear {
+		m["clear"] = true
+	}
+	return json.Marshal(m)
+}
+
+// parseNtfyAction parses an "ACTION, LABEL, URL[, clear=true][, method=METHOD]" action
+// button specification, following ntfy's short format, where ACTION is view or http.
+// method is only valid for http actions.
+func parseNtfyAction(spec string) (gotfy.ActionButton, error) {
+	parts := strings.Split(spec, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("'%s' is not in the form ACTION, LABEL, URL", spec)
+	}
+	action, label := strings.ToLower(parts[0]), parts[1]
+	if action != "view" && action != "http" {
+		return nil, fmt.Errorf("unknown action '%s' in '%s' (must be view or http)", parts[0], spec)
+	}
+	if label == "" {
+		return nil, fmt.Errorf("missing label in '%s'", spec)
+	}
+	actionURL, err := url.Parse(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL in '%s': %w", spec, err)
+	}
+	if !actionURL.IsAbs() {
+		return nil, fmt.Errorf("URL in '%s' must be absolute", spec)
+	}
+
+	clearAfter := false
+	method := ""
+	for _, param := range parts[3:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("parameter '%s' in '%s' is not in the form KEY=VALUE", param, spec)
+		}
+		switch key := strings.ToLower(strings.TrimSpace(kv[0])); {
+		case key == "clear":
+			if clearAfter, err = strconv.ParseBool(strings.TrimSpace(kv[1])); err != nil {
+				return nil, fmt.Errorf("invalid clear value in '%s': %w", spec, err)
+			}
+		case key == "method" && action == "http":
+			method = strings.ToUpper(strings.TrimSpace(kv[1]))
+		default:
+			return nil, fmt.Errorf("unsupported parameter '%s' for %s action in '%s'", kv[0], action, spec)
+		}
+	}
+
+	if action == "view" {
+		return &gotfy.ViewAction{Label: label, Link: actionURL, Clear: clearAfter}, nil
+	}
+	return &ntfyHTTPAction{label: label, url: actionURL, method: method, clear: clearAfter}, nil
+}
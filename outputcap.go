@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+)
+
+// headTailBuffer retains at most limit bytes written to it: the first limit/2 bytes
+// and the most recent limit/2 bytes. Bytes in between are discarded and counted.
+type headTailBuffer struct {
+	limit   int
+	head    []byte
+	tail    []byte
+	dropped int64
+}
+
+func newHeadTailBuffer(limit int) *headTailBuffer {
+	return &headTailBuffer{limit: limit}
+}
+
+func (b *headTailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	headMax := b.limit / 2
+	tailMax := b.limit - headMax
+
+	if len(b.head) < headMax {
+		take := headMax - len(b.head)
+		if take > len(p) {
+			take = len(p)
+		}
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+
+	b.tail = append(b.tail, p...)
+	// let tail grow to twice its maximum before trimming, to amortize the copy:
+	if len(b.tail) > 2*tailMax {
+		excess := len(b.tail) - tailMax
+		b.dropped += int64(excess)
+		b.tail = append(b.tail[:0], b.tail[excess:]...)
+	}
+	return n, nil
+}
+
+// String returns the retained output, with a marker in place of any discarded bytes.
+func (b *headTailBuffer) String() string {
+	dropped := b.dropped
+	tail := b.tail
+	if tailMax := b.limit - b.limit/2; len(tail) > tailMax {
+		dropped += int64(len(tail) - tailMax)
+		tail = tail[len(tail)-tailMax:]
+	}
+	if dropped == 0 {
+		return string(b.head) + string(tail)
+	}
+	return fmt.Sprintf("%s\n… [truncated %d bytes] …\n%s", b.head, dropped, tail)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notificationTemplateData is the data available to -output-prefix, -output-suffix, and
+// -discord-content templates.
+type notificationTemplateData struct {
+	JobName     string
+	Hostname    string
+	StartTime   time.Time
+	Status      string
+	ExitCode    int
+	SummaryLine string
+	Emoji       string
+}
+
+func newNotificationTemplateData(runOut *runOutput) notificationTemplateData {
+	return notificationTemplateData{
+		JobName:     runOut.jobName,
+		Hostname:    runOut.hostname,
+		StartTime:   runOut.startTime,
+		Status:      runOut.status,
+		ExitCode:    runOut.exitCode,
+		SummaryLine: runOut.summaryLine,
+		Emoji:       runOut.emoj,
+	}
+}
+
+// wrapOutput returns a copy of the given run output, for delivery, whose output begins with
+// the executed prefix template and ends with the executed suffix template, each on its own
+// lines. Either template may be nil.
+func wrapOutput(prefixTmpl, suffixTmpl *template.Template, runOut *runOutput) (*runOutput, error) {
+	data := newNotificationTemplateData(runOut)
+	wrapped := *runOut
+	if prefixTmpl != nil {
+		prefix := strings.Builder{}
+		if err := prefixTmpl.Execute(&prefix, data); err != nil {
+			return runOut, err
+		}
+		// the header must remain a prefix of the output:
+		wrapped.header = prefix.String() + "\n\n" + wrapped.header
+		wrapped.output = prefix.String() + "\n\n" + wrapped.output
+	}
+	if suffixTmpl != nil {
+		suffix := strings.Builder{}
+		if err := suffixTmpl.Execute(&suffix, data); err != nil {
+			return runOut, err
+		}
+		wrapped.output = strings.TrimRight(wrapped.output, "\n") + "\n\n" + suffix.String() + "\n"
+	}
+	return &wrapped, nil
+}
@@ -0,0 +1,10 @@
+package main
+
+import "syscall"
+
+const killChildrenOnDeathDefault = true
+
+// setParentDeathSignal asks the kernel to send the program SIGTERM if runner dies.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGTERM
+}
@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+const killChildrenOnDeathDefault = false
+
+func setParentDeathSignal(_ *syscall.SysProcAttr) {
+	// no-op if not on Linux
+}
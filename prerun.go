@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+const preRunOutputHeading = "--- Pre-Run Check ---\n\n"
+
+// preRunResult is the result of the -pre-run check.
+type preRunResult struct {
+	// section describes the check's exit status and output, for the run's output.
+	section string
+	passed  bool
+}
+
+// runPreRun runs the given -pre-run shell command, which gates whether the program is run,
+// in the same way as -on-success and -on-failure hooks.
+func runPreRun(config *runConfig, command string) *preRunResult {
+	childEnv := buildChildEnv(config)
+	status, out, passed := runShellCommand(config, childEnv, command)
+	section := fmt.Sprintf("%s-pre-run check (%s) %s.\n", preRunOutputHeading, command, status)
+	if out != "" {
+		section += "\n" + out
+	}
+	return &preRunResult{
+		section: outputRedactor(childEnv).Replace(section) + "\n",
+		passed:  passed,
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// setProcessGroup places the program in its own process group, so that it and its
+// descendants can be signaled together.
+func setProcessGroup(attr *syscall.SysProcAttr) {
+	attr.Setpgid = true
+}
+
+// signalProcessGroup sends sig to the process group led by p.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	return syscall.Kill(-p.Pid, sig)
+}
+
+// killProcessGroup kills the process group led by p, falling back to killing only p.
+func killProcessGroup(p *os.Process) {
+	if syscall.Kill(-p.Pid, syscall.SIGKILL) != nil {
+		_ = p.Kill()
+	}
+}
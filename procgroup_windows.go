@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func setProcessGroup(_ *syscall.SysProcAttr) {
+	// no-op on Windows
+}
+
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	// Windows doesn't support process groups in this sense, nor most signals;
+	// this will usually fail, and the caller will kill the process instead.
+	return p.Signal(sig)
+}
+
+func killProcessGroup(p *os.Process) {
+	_ = p.Kill()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+)
+
+// runResult is a machine-readable summary of a run.
+// Its JSON encoding is a stable, documented format; add fields but don't rename them.
+type runResult struct {
+	JobName    string    `json:"job_name"`
+	Hostname   string    `json:"hostname"`
+	Status     string    `json:"status"`
+	Succeeded  bool      `json:"succeeded"`
+	ExitCode   int       `json:"exit_code"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	DurationMs int64     `json:"duration_ms"`
+	// TriggeredBy is set if a -print-if-* option caused a successful run's output to be printed.
+	TriggeredBy string `json:"triggered_by,omitempty"`
+}
+
+func (o *runOutput) result() runResult {
+	return runResult{
+		JobName:     o.jobName,
+		Hostname:    o.hostname,
+		Status:      o.status,
+		Succeeded:   o.succeeded,
+		ExitCode:    o.exitCode,
+		StartTime:   o.startTime,
+		EndTime:     o.endTime,
+		DurationMs:  o.endTime.Sub(o.startTime).Milliseconds(),
+		TriggeredBy: o.triggeredBy,
+	}
+}
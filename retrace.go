@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// maxTraceAttachmentBytes is the largest trace file runner will attach to a notification;
+// larger traces are only referenced by path.
+const maxTraceAttachmentBytes = 8 * 1024 * 1024
+
+// retraceFailure re-runs the program once under `strace -f`, writing the trace to a
+// temporary file. It returns the trace file's path (empty if no trace was captured)
+// and a human-readable note describing the result.
+func retraceFailure(config *runConfig, childEnv []string) (string, string) {
+	stracePath, err := exec.LookPath("strace")
+	if err != nil {
+		return "", "strace was not found in PATH; no failure trace was captured."
+	}
+
+	traceFile, err := os.CreateTemp("", "runner-strace-*.txt")
+	if err != nil {
+		return "", fmt.Sprintf("Failed to create a temporary file for the failure trace: %s", err)
+	}
+	tracePath := traceFile.Name()
+	_ = traceFile.Close()
+	if config.runAsUser != nil {
+		if err := os.Chown(tracePath, config.runAsUser.runAsUID, config.runAsUser.runAsGID); err != nil {
+			return "", fmt.Sprintf("Failed to chown failure trace file '%s': %s", tracePath, err)
+		}
+	}
+
+	args := append([]string{"-f", "-o", tracePath, "--", config.programName}, config.programArgs...)
+	cmd := exec.Command(stracePath, args...)
+	cmd.SysProcAttr = buildSysProcAttr(config)
+	cmd.Dir = config.workDir
+	cmd.Env = childEnv
+
+	retraceCfg := *config
+	retraceCfg.timeout = config.retraceTimeout
+	retraceCfg.idleTimeout = 0
+	retraceCfg.killGrace = 0
+	retraceCfg.liveOutput = nil
+	_, stopped, err := runAttempt(cmd, &retraceCfg)
+
+	if err := redactTraceFile(tracePath, config, childEnv); err != nil {
+		_ = os.Remove(tracePath)
+		return "", fmt.Sprintf("Failed to redact censored values from the failure trace, so it was discarded: %s", err)
+	}
+
+	note := fmt.Sprintf("The program was re-run under strace; the trace was written to %s.", tracePath)
+	if stopped == stopTimeout {
+		note += fmt.Sprintf(" (The traced run timed out after %s.)", config.retraceTimeout)
+	} else if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return "", fmt.Sprintf("Failed to re-run the program under strace: %s", err)
+		}
+	}
+	return tracePath, note
+}
+
+// redactTraceFile rewrites the trace file at path with the values of censored environment
+// variables redacted, since strace records the program's environment and any secrets it
+// reads or writes.
+func redactTraceFile(path string, config *runConfig, childEnv []string) error {
+	secrets := censoredValues(childEnv)
+	if len(secrets) == 0 {
+		return nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(filepath.Dir(path), "runner-strace-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	redactor := newRedactingWriter(dst, secrets)
+	if _, err := io.Copy(redactor, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := redactor.Flush(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if config.runAsUser != nil {
+		if err := os.Chown(dst.Name(), config.runAsUser.runAsUID, config.runAsUser.runAsGID); err != nil {
+			return err
+		}
+	}
+	return os.Rename(dst.Name(), path)
+}
+
+// attachableTraceFile returns the trace file's name and content, if runOutput has a
+// trace file small enough to attach to a notification.
+func attachableTraceFile(runOutput *runOutput) (string, []byte, bool) {
+	if runOutput.traceFile == "" {
+		return "", nil, false
+	}
+	fi, err := os.Stat(runOutput.traceFile)
+	if err != nil || fi.Size() > maxTraceAttachmentBytes {
+		return "", nil, false
+	}
+	content, err := os.ReadFile(runOutput.traceFile)
+	if err != nil {
+		return "", nil, false
+	}
+	return filepath.Base(runOutput.traceFile), content, true
+}
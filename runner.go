@@ -1,11 +1,15 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -20,20 +24,58 @@ type runConfig struct {
 	workDir          string
 	healthyExitCodes IntSlice
 	retries          int
+	retryUntilMatch  string
 	retryDelay       time.Duration
+	retryBackoff     bool
+	retryMaxDelay    time.Duration
+	retryJitter      int // percent
 	outputConfig     *runOutputConfig
+	liveOutput       io.Writer
+	maxOutputBytes   int
+	separateStreams  bool
 	runAsUser        *runAsUserConfig
+	noNewPrivs       bool
+	chroot           string
+	extraEnv         []string // from -env-file and -env, in order; later entries override earlier ones
+	clearEnv         bool
+	nice             int
+	ioPriorityClass  int // ioPriorityClassNone to leave the program's I/O priority unchanged
+	ioPriorityLevel  int
 	timeout          time.Duration
+	maxRuntime       time.Duration // across all tries and retry delays
+	idleTimeout      time.Duration
+	killGrace        time.Duration
+	gracefulSignal   syscall.Signal
+	killOnDeath      bool
+	retraceOnFailure bool
+	retraceTimeout   time.Duration
+	partialDuration  time.Duration
+	onSuccess        string
+	onFailure        string
+	preRunResult     *preRunResult // the -pre-run check's result, if any
 }
 
+// runOutputConfig's displayName, if set, replaces jobName in the output's summary line.
 type runOutputConfig struct {
-	jobName         string
-	hostname        string
-	hideEnv         bool
-	alwaysPrint     bool
-	printIfMatch    StringSlice
-	printIfNotMatch StringSlice
-	setupWarnings   StringSlice
+	jobName            string
+	displayName        string
+	hostname           string
+	hideEnv            bool
+	shownEnvVars       []string
+	printEnvDiff       bool
+	minimalSummary     bool
+	noEmoji            bool
+	systemStats        bool
+	alwaysPrint        bool
+	printIfMatch       StringSlice
+	printIfNotMatch    StringSlice
+	printIfStderrMatch StringSlice
+	printIfMatchRe     []*regexp.Regexp
+	printIfNotMatchRe  []*regexp.Regexp
+	setupWarnings      StringSlice
+	priorityForExit    map[int]int
+	tailFiles          []tailFileSpec
+	recentDurations    []time.Duration
 }
 
 // runAsUserConfig, if non-nil, must be internally consistent (e.g. the sysProcAttr
@@ -46,22 +88,73 @@ type runAsUserConfig struct {
 	userHome      string
 }
 
+// runOutput's priority is 0 if no notification priority was mapped to the exit code.
+// header is the portion of output which precedes the program's output.
 type runOutput struct {
 	output      string
+	header      string
 	summaryLine string
+	firstLine   string
 	emoj        string
+	status      string
 	jobName     string
+	hostname    string
+	exitCode    int
+	priority    int
+	traceFile   string
 	startTime   time.Time
 	endTime     time.Time
 	succeeded   bool
+	partial     bool
 	shouldPrint bool
+
+	// triggeredBy describes the -print-if-* option, if any, which caused a successful run's output to be printed.
+	triggeredBy string
+
+	// stdout and stderr are the last attempt's output streams, if they were captured separately.
+	stdout string
+	stderr string
+
+	setupWarnings []string
+}
+
+const (
+	failedEmoj    = "🔴"
+	partialEmoj   = "⚠️"
+	succeededEmoj = "🟢"
+)
+
+// textStatusMarkers replace status emoji (which some mail clients and terminals render
+// poorly) with plain text when -no-emoji is given or NO_COLOR is set.
+var textStatusMarkers = map[string]string{
+	failedEmoj:    "[FAIL]",
+	partialEmoj:   "[WARN]",
+	succeededEmoj: "[OK]",
+	startEmoj:     "[START]",
+	testEmoj:      "[TEST]",
+	crashEmoj:     "[CRASH]",
+}
+
+// statusMarker returns the given status emoji, or its text replacement if noEmoji is set.
+func statusMarker(emoj string, noEmoji bool) string {
+	if noEmoji {
+		return textStatusMarkers[emoj]
+	}
+	return emoj
 }
 
 const (
 	statusFailed    = "Failed"
 	statusSucceeded = "Succeeded"
+	statusPartial   = "Partially succeeded"
 )
 
+const programOutputHeading = "--- Program Output ---\n\n"
+
+const noProgramOutputNote = "(no output produced)\n"
+
+const preRunFailedNote = "(not run, because the -pre-run check failed)\n"
+
 func runner(config *runConfig) *runOutput {
 	programOutput := strings.Builder{}
 	var startTime, endTime time.Time
@@ -70,52 +163,91 @@ func runner(config *runConfig) *runOutput {
 	succeeded := false
 	shouldPrint := true
 	exitCode := -1
+	exitCodeReason := ""
+	attempts := 0
+	timedOutAttempts := 0
+	idleAttempts := 0
+	firstLine := ""
+	triggeredBy := ""
+	stdout, stderr := "", ""
+	exceededMaxRuntime := false
+	childEnv := buildChildEnv(config)
+	redactor := outputRedactor(childEnv)
+
+	preRunFailed := config.preRunResult != nil && !config.preRunResult.passed
+	if preRunFailed {
+		exitCodeReason = "the -pre-run check failed"
+		startTime = time.Now()
+		endTime = startTime
+	}
 
-	for triesRemaining > 0 {
+	runStart := time.Now()
+	for triesRemaining > 0 && !preRunFailed {
 		isRetry := config.retries > 0 && triesRemaining != 1+config.retries
 		if isRetry {
-			if config.retryDelay > 0 {
-				time.Sleep(config.retryDelay)
+			delay := config.retryDelayFor(attempts)
+			if config.maxRuntime > 0 && time.Since(runStart)+delay >= config.maxRuntime {
+				exceededMaxRuntime = true
+				break
+			}
+			if delay > 0 {
+				time.Sleep(delay)
+			}
+			retryBanner := fmt.Sprintf("\n- Retrying after %.0f seconds -\n\n", delay.Round(time.Second).Seconds())
+			programOutput.WriteString(retryBanner)
+			if config.liveOutput != nil {
+				_, _ = io.WriteString(config.liveOutput, retryBanner)
 			}
-			programOutput.WriteString(fmt.Sprintf(
-				"\n- Retrying after %.0f seconds -\n\n",
-				config.retryDelay.Round(time.Second).Seconds(),
-			))
 		}
 		triesRemaining--
+		attempts++
 
-		execCtx := context.Background()
-		var execCancel context.CancelFunc
-		if config.timeout > 0 {
-			execCtx, execCancel = context.WithTimeout(execCtx, config.timeout)
-		}
-		cmd := exec.CommandContext(execCtx, config.programName, config.programArgs...)
-		if config.runAsUser != nil {
-			cmd.SysProcAttr = config.runAsUser.sysProcAttr
+		cmd := exec.Command(config.programName, config.programArgs...)
+		if config.chroot != "" {
+			// the program is found within the chroot, rather than on runner's own PATH:
+			cmd.Path, cmd.Err = lookPathInChroot(config.chroot, config.programName, childEnv)
 		}
+		cmd.SysProcAttr = buildSysProcAttr(config)
 		cmd.Dir = config.workDir
-		cmd.Env = os.Environ()
-		if config.runAsUser != nil && config.runAsUser.userHome != "" {
-			for i, v := range cmd.Env {
-				if strings.HasPrefix(v, "HOME=") {
-					cmd.Env = append(cmd.Env[:i], cmd.Env[i+1:]...)
-					break
-				}
+		cmd.Env = childEnv
+		// the try's timeout is limited to what remains of -max-runtime:
+		attemptCfg := config
+		limitedByMaxRuntime := false
+		if config.maxRuntime > 0 {
+			remaining := config.maxRuntime - time.Since(runStart)
+			if remaining <= 0 {
+				exceededMaxRuntime = true
+				break
+			}
+			if config.timeout == 0 || remaining < config.timeout {
+				limited := *config
+				limited.timeout = remaining
+				attemptCfg = &limited
+				limitedByMaxRuntime = true
 			}
-			cmd.Env = append(cmd.Env, "HOME="+config.runAsUser.userHome)
 		}
 		startTime = time.Now()
-		cmdOut, err := cmd.CombinedOutput()
+		cmdOut, stopped, err := runAttempt(cmd, attemptCfg)
+		cmdOutStr := redactor.Replace(cmdOut.combined)
+		stdout, stderr = redactor.Replace(cmdOut.stdout), redactor.Replace(cmdOut.stderr)
 		endTime = time.Now()
-		cmdOutStr := string(cmdOut)
-		if execCancel != nil {
-			execCancel()
+		if firstLine == "" {
+			firstLine = firstNonEmptyLine(cmdOutStr)
 		}
 
+		switch {
+		case stopped == stopTimeout && limitedByMaxRuntime:
+			exceededMaxRuntime = true
+			triesRemaining = 0
+			cmdOutStr = fmt.Sprintf("%s\n(stopped after exceeding max runtime of %s)\n", cmdOutStr, config.maxRuntime)
+		case stopped == stopTimeout:
+			timedOutAttempts++
+			cmdOutStr = fmt.Sprintf("%s\n(timed out after %s)\n", cmdOutStr, config.timeout)
+		case stopped == stopIdle:
+			idleAttempts++
+			cmdOutStr = fmt.Sprintf("%s\n(killed after %s of inactivity)\n", cmdOutStr, config.idleTimeout)
+		}
 		if err != nil {
-			if errors.Is(execCtx.Err(), context.DeadlineExceeded) {
-				cmdOutStr = fmt.Sprintf("%s\n(timed out after %.0f seconds)\n", cmdOutStr, config.timeout.Seconds())
-			}
 			var exitError *exec.ExitError
 			if errors.As(err, &exitError) {
 				// cmd started, but did not return a healthy exit code.
@@ -126,24 +258,33 @@ func runner(config *runConfig) *runOutput {
 			}
 		}
 
+		// the summary reports the last attempt's exit code, or -1 if it didn't run:
+		exitCode = -1
+		exitCodeReason = ""
 		if cmd.ProcessState != nil {
 			exitCode = cmd.ProcessState.ExitCode()
+			exitCodeReason = exitReason(cmd.ProcessState)
 		}
 		programOutput.WriteString(cmdOutStr)
 
-		for _, v := range config.healthyExitCodes {
-			if exitCode == v {
-				succeeded = true
-				shouldPrint = config.outputConfig.alwaysPrint
-				triesRemaining = 0
-				break
-			}
+		healthy := false
+		if config.retryUntilMatch != "" {
+			// the output, not the exit code, determines success when polling:
+			healthy = strings.Contains(cmdOutStr, config.retryUntilMatch)
+		} else if stopped == stopNone {
+			healthy = intSliceContains(config.healthyExitCodes, exitCode)
+		}
+		if healthy {
+			succeeded = true
+			shouldPrint = config.outputConfig.alwaysPrint
+			triesRemaining = 0
 		}
 
 		if !shouldPrint {
 			for _, v := range config.outputConfig.printIfMatch {
 				if strings.Contains(cmdOutStr, v) {
 					shouldPrint = true
+					triggeredBy = fmt.Sprintf("print-if-match: \"%s\"", v)
 					break
 				}
 			}
@@ -152,6 +293,34 @@ func runner(config *runConfig) *runOutput {
 			for _, v := range config.outputConfig.printIfNotMatch {
 				if !strings.Contains(cmdOutStr, v) {
 					shouldPrint = true
+					triggeredBy = fmt.Sprintf("print-if-not-match: \"%s\"", v)
+					break
+				}
+			}
+		}
+		if !shouldPrint {
+			for _, v := range config.outputConfig.printIfStderrMatch {
+				if strings.Contains(stderr, v) {
+					shouldPrint = true
+					triggeredBy = fmt.Sprintf("print-if-stderr-match: \"%s\"", v)
+					break
+				}
+			}
+		}
+		if !shouldPrint {
+			for _, re := range config.outputConfig.printIfMatchRe {
+				if re.MatchString(cmdOutStr) {
+					shouldPrint = true
+					triggeredBy = fmt.Sprintf("print-if-match-regex: \"%s\"", re.String())
+					break
+				}
+			}
+		}
+		if !shouldPrint {
+			for _, re := range config.outputConfig.printIfNotMatchRe {
+				if !re.MatchString(cmdOutStr) {
+					shouldPrint = true
+					triggeredBy = fmt.Sprintf("print-if-not-match-regex: \"%s\"", re.String())
 					break
 				}
 			}
@@ -167,55 +336,158 @@ func runner(config *runConfig) *runOutput {
 		}
 	}
 
-	statusEmoj := "🔴"
+	// A run is "partial" if it succeeded but was degraded in some way; partial runs
+	// are printed and delivered like failures, but still count as successes otherwise.
+	partialReason := ""
+	if succeeded && config.partialDuration > 0 && endTime.Sub(startTime) > config.partialDuration {
+		partialReason = fmt.Sprintf("ran longer than %s", config.partialDuration)
+	}
+	partial := partialReason != ""
+	if partial {
+		shouldPrint = true
+	}
+
+	statusEmoj := failedEmoj
 	statusStr := statusFailed
-	if succeeded {
-		statusEmoj = "🟢"
+	if partial {
+		statusEmoj = partialEmoj
+		statusStr = statusPartial
+	} else if succeeded {
+		statusEmoj = succeededEmoj
 		statusStr = statusSucceeded
 	}
 
-	jobSummaryOutput := fmt.Sprintf(
-		"[%s] %s running %s\n"+
-			"Working directory: %s\n"+
-			"Command: %s\n"+
-			"Exit code: %d\n\n"+
-			"Duration: %s\n"+
-			"Start time: %s\n"+
-			"End time: %s\n"+
-			"Retries allowed: %d\n\n",
-		config.outputConfig.hostname,
-		statusStr,
-		config.outputConfig.jobName,
-		config.workDir,
-		exec.Command(config.programName, config.programArgs...).String(),
-		exitCode,
-		endTime.Sub(startTime).String(),
-		startTime.Format("2006-01-02 15:04:05.000 -0700"),
-		endTime.Format("2006-01-02 15:04:05.000 -0700"),
-		config.retries,
-	)
+	exitCodeStr := fmt.Sprintf("%d", exitCode)
+	if exitCodeReason != "" {
+		exitCodeStr = fmt.Sprintf("%d (%s)", exitCode, exitCodeReason)
+	}
+
+	durationStr := endTime.Sub(startTime).String()
+	if comparison := durationComparison(endTime.Sub(startTime), config.outputConfig.recentDurations); comparison != "" {
+		durationStr = fmt.Sprintf("%s (%s)", durationStr, comparison)
+	}
+
+	var jobSummaryOutput string
+	if config.outputConfig.minimalSummary {
+		jobSummaryOutput = fmt.Sprintf(
+			"[%s] %s running %s\n"+
+				"Exit code: %s\n"+
+				"Duration: %s\n\n",
+			config.outputConfig.hostname,
+			statusStr,
+			config.outputConfig.label(),
+			exitCodeStr,
+			durationStr,
+		)
+	} else {
+		jobSummaryOutput = fmt.Sprintf(
+			"[%s] %s running %s\n"+
+				"Working directory: %s\n"+
+				"Command: %s\n"+
+				"Exit code: %s\n\n"+
+				"Duration: %s\n"+
+				"Start time: %s\n"+
+				"End time: %s\n"+
+				"Retries allowed: %d\n\n",
+			config.outputConfig.hostname,
+			statusStr,
+			config.outputConfig.label(),
+			config.workDir,
+			exec.Command(config.programName, config.programArgs...).String(),
+			exitCodeStr,
+			durationStr,
+			startTime.Format("2006-01-02 15:04:05.000 -0700"),
+			endTime.Format("2006-01-02 15:04:05.000 -0700"),
+			config.retries,
+		)
+	}
 	output := strings.Builder{}
 	output.WriteString(jobSummaryOutput)
-	if config.runAsUser != nil {
+	if config.outputConfig.systemStats {
+		if stats := systemStats(); stats != "" {
+			output.WriteString(fmt.Sprintf("System: %s\n\n", stats))
+		}
+	}
+	if partial {
+		output.WriteString(fmt.Sprintf("Partial success: %s\n\n", partialReason))
+	}
+	if triggeredBy != "" {
+		output.WriteString(fmt.Sprintf("Triggered by %s\n\n", triggeredBy))
+	}
+	if timedOutAttempts > 0 {
+		output.WriteString(fmt.Sprintf("Timed out after %s (%d of %d attempt(s) exceeded the per-attempt timeout)\n\n",
+			config.timeout, timedOutAttempts, attempts))
+	}
+	if exceededMaxRuntime && !succeeded {
+		output.WriteString(fmt.Sprintf("Exceeded max runtime of %s (after %d attempt(s))\n\n", config.maxRuntime, attempts))
+	}
+	if config.retryUntilMatch != "" {
+		if succeeded {
+			output.WriteString(fmt.Sprintf("Polls: output matched \"%s\" after %d poll(s)\n\n", config.retryUntilMatch, attempts))
+		} else {
+			output.WriteString(fmt.Sprintf("Polls: output did not match \"%s\" in %d poll(s)\n\n", config.retryUntilMatch, attempts))
+		}
+	}
+	if idleAttempts > 0 {
+		output.WriteString(fmt.Sprintf("Idle timeout: %d of %d attempt(s) killed after %s of inactivity\n\n",
+			idleAttempts, attempts, config.idleTimeout))
+	}
+	if config.runAsUser != nil && !config.outputConfig.minimalSummary {
 		if config.runAsUser.runAsUserName != "" {
 			output.WriteString(fmt.Sprintf("Run as user %s:\n", config.runAsUser.runAsUserName))
 		} else {
 			output.WriteString("Run as:\n")
 		}
 		output.WriteString(fmt.Sprintf("\tUID: %d\n", config.runAsUser.runAsUID))
-		output.WriteString(fmt.Sprintf("\tGID: %d\n\n", config.runAsUser.runAsGID))
+		output.WriteString(fmt.Sprintf("\tGID: %d\n", config.runAsUser.runAsGID))
+		if groups := config.runAsUser.sysProcAttr.Credential.Groups; len(groups) > 0 {
+			groupStrs := make([]string, len(groups))
+			for i, gid := range groups {
+				groupStrs[i] = strconv.FormatUint(uint64(gid), 10)
+			}
+			output.WriteString(fmt.Sprintf("\tGroups: %s\n", strings.Join(groupStrs, ",")))
+		}
+		output.WriteRune('\n')
 	}
-	if !config.outputConfig.hideEnv {
+	showEnv := !config.outputConfig.hideEnv && !config.outputConfig.minimalSummary
+	if showEnv && config.outputConfig.printEnvDiff {
+		output.WriteString("Environment changes (program vs. runner):\n")
+		changes := envDiff(os.Environ(), childEnv, config.outputConfig.shownEnvVars)
+		if len(changes) == 0 {
+			output.WriteString("\t(none)\n")
+		}
+		for _, change := range changes {
+			output.WriteString(fmt.Sprintf("\t%s\n", change))
+		}
+		output.WriteRune('\n')
+	} else if showEnv {
+		// with -clear-env, list the program's (small) environment instead of runner's:
+		envVars, extraEnv := os.Environ(), config.extraEnv
+		if config.clearEnv {
+			envVars, extraEnv = childEnv, nil
+		}
 		output.WriteString("Environment:\n")
-		for _, envVar := range os.Environ() {
+		for _, envVar := range envVars {
 			envVarPair := strings.SplitN(envVar, "=", 2)
 			envVarName := envVarPair[0]
-			if shouldHideEnvVar(envVarName) {
+			if shouldHideEnvVar(envVarName, config.outputConfig.shownEnvVars) {
 				continue
 			}
 			output.WriteString(fmt.Sprintf("\t%s=%s\n", envVarName, censoredEnvVarValue(envVarName, envVarPair[1])))
 		}
 		output.WriteRune('\n')
+		if len(extraEnv) > 0 {
+			extraEnvVars := envMap(extraEnv)
+			output.WriteString("Environment from -env-file and -env:\n")
+			for _, envVar := range childEnv {
+				envVarPair := strings.SplitN(envVar, "=", 2)
+				if _, ok := extraEnvVars[envVarPair[0]]; !ok || shouldHideEnvVar(envVarPair[0], config.outputConfig.shownEnvVars) {
+					continue
+				}
+				output.WriteString(fmt.Sprintf("\t%s=%s\n", envVarPair[0], censoredEnvVarValue(envVarPair[0], envVarPair[1])))
+			}
+			output.WriteRune('\n')
+		}
 	}
 	if len(config.outputConfig.setupWarnings) > 0 {
 		output.WriteString("--- Runner Setup Warnings ---\n\n")
@@ -225,27 +497,192 @@ func runner(config *runConfig) *runOutput {
 		}
 		output.WriteRune('\n')
 	}
-	output.WriteString("--- Program Output ---\n\n")
-	if programOutput.Len() == 0 {
-		output.WriteString("(no output produced)\n")
+	// the -pre-run check is part of the header, so e.g. -quiet omits it with the rest of the header:
+	if config.preRunResult != nil {
+		output.WriteString(config.preRunResult.section)
+	}
+	header := output.String()
+	output.WriteString(programOutputHeading)
+	if preRunFailed {
+		output.WriteString(preRunFailedNote)
+	} else if programOutput.Len() == 0 {
+		output.WriteString(noProgramOutputNote)
 	} else {
 		output.WriteString(programOutput.String())
 	}
+	for _, spec := range config.outputConfig.tailFiles {
+		output.WriteString(redactor.Replace(tailFileSection(spec)))
+	}
+	traceFile := ""
+	if !succeeded && config.retraceOnFailure {
+		var traceNote string
+		traceFile, traceNote = retraceFailure(config, childEnv)
+		output.WriteString("\n--- Failure Trace ---\n\n")
+		output.WriteString(traceNote)
+		output.WriteRune('\n')
+	}
+	if succeeded && config.onSuccess != "" {
+		output.WriteString(redactor.Replace(runHook(config, childEnv, "on-success", config.onSuccess)))
+	} else if !succeeded && config.onFailure != "" {
+		output.WriteString(redactor.Replace(runHook(config, childEnv, "on-failure", config.onFailure)))
+	}
 
-	summaryLine := fmt.Sprintf("[%s] %s running %s", config.outputConfig.hostname, statusStr, config.outputConfig.jobName)
+	summaryLine := fmt.Sprintf("[%s] %s running %s", config.outputConfig.hostname, statusStr, config.outputConfig.label())
 
 	return &runOutput{
 		output:      output.String(),
+		header:      header,
 		summaryLine: summaryLine,
+		firstLine:   firstLine,
 		jobName:     config.outputConfig.jobName,
+		hostname:    config.outputConfig.hostname,
+		exitCode:    exitCode,
+		priority:    config.outputConfig.priorityForExit[exitCode],
+		traceFile:   traceFile,
 		startTime:   startTime,
 		endTime:     endTime,
 		shouldPrint: shouldPrint,
+		triggeredBy: triggeredBy,
 		succeeded:   succeeded,
-		emoj:        statusEmoj,
+		partial:     partial,
+		emoj:        statusMarker(statusEmoj, config.outputConfig.noEmoji),
+		status:      statusStr,
+
+		stdout:        stdout,
+		stderr:        stderr,
+		setupWarnings: config.outputConfig.setupWarnings,
+	}
+}
+
+// retryJitterRand randomizes retry delays per -retry-jitter. It's seeded per process, so that
+// hosts running the same job don't retry in lockstep.
+var retryJitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// retryDelayFor returns the delay before the retry following the given number of attempts.
+// With retryBackoff, the delay doubles after each retry, up to retryMaxDelay (if nonzero).
+// With retryJitter, the delay is then randomly adjusted by up to that percentage.
+func (c *runConfig) retryDelayFor(attempts int) time.Duration {
+	delay := c.retryDelay
+	if c.retryBackoff {
+		// stop doubling before the delay overflows, e.g. with many retries and no retryMaxDelay:
+		for i := 1; i < attempts && (c.retryMaxDelay == 0 || delay < c.retryMaxDelay) && delay <= math.MaxInt64/2; i++ {
+			delay *= 2
+		}
+		if c.retryMaxDelay > 0 && delay > c.retryMaxDelay {
+			delay = c.retryMaxDelay
+		}
+	}
+	if c.retryJitter > 0 && delay > 0 {
+		maxJitter := int64(delay) / 100 * int64(c.retryJitter)
+		if headroom := int64(math.MaxInt64 - delay); maxJitter > headroom {
+			maxJitter = headroom
+		}
+		delay += time.Duration(retryJitterRand.Int63n(2*maxJitter+1) - maxJitter)
+	}
+	return delay
+}
+
+// buildSysProcAttr returns the SysProcAttr for the program's process, or nil if none is needed.
+// It does not modify config.runAsUser.sysProcAttr.
+func buildSysProcAttr(config *runConfig) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{}
+	needed := false
+	if config.runAsUser != nil {
+		*attr = *config.runAsUser.sysProcAttr
+		needed = true
+	}
+	if config.chroot != "" {
+		setChroot(attr, config.chroot)
+		needed = true
+	}
+	if config.killOnDeath {
+		setParentDeathSignal(attr)
+		needed = true
+	}
+	if config.timeout > 0 || config.idleTimeout > 0 || config.maxRuntime > 0 {
+		// allow a stopped program's descendants to be stopped along with it:
+		setProcessGroup(attr)
+		needed = true
+	}
+	if !needed {
+		return nil
+	}
+	return attr
+}
+
+// buildChildEnv returns the environment the program will be run with.
+func buildChildEnv(config *runConfig) []string {
+	env := os.Environ()
+	if config.clearEnv {
+		var minimalEnv []string
+		for _, v := range env {
+			if strings.HasPrefix(v, "HOME=") || strings.HasPrefix(v, "PATH=") {
+				minimalEnv = append(minimalEnv, v)
+			}
+		}
+		env = minimalEnv
+	}
+	if config.runAsUser != nil && config.runAsUser.userHome != "" {
+		for i, v := range env {
+			if strings.HasPrefix(v, "HOME=") {
+				env = append(env[:i], env[i+1:]...)
+				break
+			}
+		}
+		env = append(env, "HOME="+config.runAsUser.userHome)
+	}
+	for _, v := range config.extraEnv {
+		name := strings.SplitN(v, "=", 2)[0]
+		for i, existing := range env {
+			if strings.HasPrefix(existing, name+"=") {
+				env = append(env[:i], env[i+1:]...)
+				break
+			}
+		}
+		env = append(env, v)
+	}
+	return env
+}
+
+// firstNonEmptyLine returns the first line of s which isn't entirely whitespace, trimmed,
+// or an empty string if there is no such line.
+func firstNonEmptyLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// maxTitleLineLength is the longest output line runner will add to a notification's title.
+const maxTitleLineLength = 100
+
+// truncateString shortens s to at most maxRunes runes, marking truncation with an ellipsis.
+func truncateString(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
+
+// label returns the name used to describe the job in output.
+func (c *runOutputConfig) label() string {
+	if c.displayName != "" {
+		return c.displayName
 	}
+	return c.jobName
 }
 
 func (c *runOutputConfig) addSetupWarning(warning string) {
 	c.setupWarnings = append(c.setupWarnings, warning)
 }
+
+// addSetupWarningOnce adds the given warning unless it has already been added, e.g. by a
+// previous attempt.
+func (c *runOutputConfig) addSetupWarningOnce(warning string) {
+	if !stringSliceContains(c.setupWarnings, warning) {
+		c.addSetupWarning(warning)
+	}
+}
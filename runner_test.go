@@ -0,0 +1,62 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunnerReportsLastExitCodeAfterRetries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	config := &runConfig{
+		programName:      "sh",
+		programArgs:      []string{"-c", "exit 3"},
+		healthyExitCodes: IntSlice{0},
+		retries:          2,
+		outputConfig: &runOutputConfig{
+			jobName:  "exit3",
+			hostname: "testhost",
+			hideEnv:  true,
+		},
+	}
+
+	runOut := runner(config)
+
+	if runOut.succeeded {
+		t.Fatal("expected the run to fail")
+	}
+	if runOut.exitCode != 3 {
+		t.Errorf("exitCode = %d, want 3", runOut.exitCode)
+	}
+	if want := "[testhost] Failed running exit3"; runOut.summaryLine != want {
+		t.Errorf("summaryLine = %q, want %q", runOut.summaryLine, want)
+	}
+	if !strings.Contains(runOut.header, "Exit code: 3\n") {
+		t.Errorf("summary doesn't contain \"Exit code: 3\":\n%s", runOut.header)
+	}
+}
+
+func TestRetryDelayForDoesNotOverflowWithManyAttempts(t *testing.T) {
+	config := &runConfig{
+		retryDelay:   time.Second,
+		retryBackoff: true,
+	}
+	previous := time.Duration(0)
+	for _, attempts := range []int{1, 10, 40, 63, 64, 100, 1000} {
+		delay := config.retryDelayFor(attempts)
+		if delay < previous {
+			t.Errorf("retryDelayFor(%d) = %s, less than the previous delay %s", attempts, delay, previous)
+		}
+		previous = delay
+	}
+
+	config.retryJitter = 100
+	for _, attempts := range []int{40, 100, 1000} {
+		if delay := config.retryDelayFor(attempts); delay < 0 {
+			t.Errorf("retryDelayFor(%d) with jitter = %s, want a non-negative delay", attempts, delay)
+		}
+	}
+}
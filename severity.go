@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Notification priorities are an abstract 1-5 severity scale, matching ntfy's
+// priority levels: 1 is the least urgent, 3 is the default, and 5 is the most urgent.
+const (
+	minPriority = 1
+	maxPriority = 5
+)
+
+// parsePriorityForExit parses a "CODE=PRIORITY" mapping.
+func parsePriorityForExit(spec string) (int, int, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("'%s' is not in the form CODE=PRIORITY", spec)
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid exit code in '%s': %w", spec, err)
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid priority in '%s': %w", spec, err)
+	}
+	if priority < minPriority || priority > maxPriority {
+		return 0, 0, fmt.Errorf("priority in '%s' must be between %d-%d, inclusive", spec, minPriority, maxPriority)
+	}
+	return code, priority, nil
+}
+
+// pagerdutySeverity maps a priority to a PagerDuty event severity.
+func pagerdutySeverity(priority int) string {
+	switch priority {
+	case 1, 2:
+		return "info"
+	case 3:
+		return "warning"
+	case 4:
+		return "error"
+	default:
+		return "critical"
+	}
+}
+
+// priorityColor maps a priority to a color for chat embeds.
+func priorityColor(priority int) int {
+	switch priority {
+	case 1:
+		return 0x95a5a6 // gray
+	case 2:
+		return 0x3498db // blue
+	case 3:
+		return 0xf1c40f // yellow
+	case 4:
+		return 0xe67e22 // orange
+	default:
+		return 0xe74c3c // red
+	}
+}
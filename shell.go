@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+// shellCommand returns the program and arguments which run the given command line via a
+// shell, for -shell: $SHELL -c (or /bin/sh -c, if $SHELL isn't set), or cmd /C on Windows.
+func shellCommand(command string) (string, []string) {
+	//goland:noinspection GoBoolExpressions
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", command}
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return shell, []string{"-c", command}
+}
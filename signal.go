@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+const defaultGracefulSignal = syscall.SIGTERM
+
+var gracefulSignals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// parseSignal parses a signal name (e.g. "SIGINT", "int", or "INT") into one of gracefulSignals.
+func parseSignal(name string) (syscall.Signal, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(normalized, "SIG") {
+		normalized = "SIG" + normalized
+	}
+	sig, ok := gracefulSignals[normalized]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal '%s' (must be one of: SIGHUP, SIGINT, SIGQUIT, SIGTERM)", name)
+	}
+	return sig, nil
+}
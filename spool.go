@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// spoolConfig, if provided, enables spooling notifications which failed to deliver,
+// so they can be re-delivered by a later invocation of runner.
+type spoolConfig struct {
+	spoolDir string
+	maxAge   time.Duration
+}
+
+const (
+	spoolDirPerm  = 0700
+	spoolFilePerm = 0600
+
+	spoolFileExt    = ".json"
+	spoolSendingExt = ".sending"
+)
+
+// spoolEntry is a notification which failed to deliver via a single channel.
+// It deliberately contains no channel configuration (which may include secrets);
+// it is re-delivered using the configuration of the runner invocation which flushes it.
+// TraceFile, the -retrace-on-failure trace, is only attached on re-delivery if it still exists.
+type spoolEntry struct {
+	CreatedAt   time.Time `json:"created_at"`
+	Channel     string    `json:"channel"`
+	JobName     string    `json:"job_name"`
+	Hostname    string    `json:"hostname"`
+	SummaryLine string    `json:"summary_line"`
+	Emoj        string    `json:"emoj"`
+	Status      string    `json:"status"`
+	Output      string    `json:"output"`
+	Header      string    `json:"header"`
+	ExitCode    int       `json:"exit_code"`
+	Priority    int       `json:"priority,omitempty"`
+	Succeeded   bool      `json:"succeeded"`
+	Partial     bool      `json:"partial,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	LogFileName string    `json:"log_file_name"`
+	TraceFile   string    `json:"trace_file,omitempty"`
+}
+
+// spoolFailedDeliveries writes a spool entry for each failed delivery in results.
+func spoolFailedDeliveries(cfg *spoolConfig, runOut *runOutput, logFileName string, results []deliveryResult) []error {
+	var errs []error
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		errs = extendErrSlice(errs, writeSpoolEntry(cfg, &spoolEntry{
+			CreatedAt:   time.Now(),
+			Channel:     r.channel,
+			JobName:     runOut.jobName,
+			Hostname:    runOut.hostname,
+			SummaryLine: runOut.summaryLine,
+			Emoj:        runOut.emoj,
+			Status:      runOut.status,
+			Output:      runOut.output,
+			Header:      runOut.header,
+			ExitCode:    runOut.exitCode,
+			Priority:    runOut.priority,
+			Succeeded:   runOut.succeeded,
+			Partial:     runOut.partial,
+			StartTime:   runOut.startTime,
+			EndTime:     runOut.endTime,
+			LogFileName: logFileName,
+			TraceFile:   runOut.traceFile,
+		}))
+	}
+	return errs
+}
+
+func writeSpoolEntry(cfg *spoolConfig, entry *spoolEntry) error {
+	if err := os.MkdirAll(cfg.spoolDir, spoolDirPerm); err != nil {
+		return fmt.Errorf("failed to create spool directory '%s': %w", cfg.spoolDir, err)
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode spool entry: %w", err)
+	}
+	// entries are named so that sorting by name sorts them by creation time:
+	name := fmt.Sprintf("%020d-%s-%s%s", entry.CreatedAt.UnixNano(), removeBadFilenameChars(entry.JobName), entry.Channel, spoolFileExt)
+	spoolPath := filepath.Join(cfg.spoolDir, name)
+	if err := os.WriteFile(spoolPath, content, spoolFilePerm); err != nil {
+		return fmt.Errorf("failed to write spool entry '%s': %w", spoolPath, err)
+	}
+	return nil
+}
+
+// flushSpool attempts to re-deliver each spooled notification, oldest first, via the
+// currently configured channels. Entries are removed once delivered or once they are
+// older than cfg.maxAge. Entries for channels which aren't currently configured are left
+// for a later invocation.
+func flushSpool(cfg *spoolConfig, deliveryCfg *deliveryConfig) []error {
+	dirEntries, err := os.ReadDir(cfg.spoolDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []error{fmt.Errorf("failed to read spool directory '%s': %w", cfg.spoolDir, err)}
+	}
+	var names []string
+	for _, e := range dirEntries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolFileExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		spoolPath := filepath.Join(cfg.spoolDir, name)
+		// claim the entry, so concurrent runner invocations don't deliver it twice:
+		sendingPath := spoolPath + spoolSendingExt
+		if err := os.Rename(spoolPath, sendingPath); err != nil {
+			continue
+		}
+		errs = extendErrSlice(errs, flushSpoolEntry(cfg, deliveryCfg, sendingPath))
+	}
+	return errs
+}
+
+// flushSpoolEntry attempts to re-deliver the claimed spool entry at sendingPath.
+// The entry is removed if it was delivered or is too old, and otherwise is returned to the spool.
+func flushSpoolEntry(cfg *spoolConfig, deliveryCfg *deliveryConfig, sendingPath string) error {
+	spoolPath := strings.TrimSuffix(sendingPath, spoolSendingExt)
+	content, err := os.ReadFile(sendingPath)
+	if err != nil {
+		_ = os.Rename(sendingPath, spoolPath)
+		return fmt.Errorf("failed to read spool entry '%s': %w", spoolPath, err)
+	}
+	var entry spoolEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		_ = os.Remove(sendingPath)
+		return fmt.Errorf("discarded unreadable spool entry '%s': %w", spoolPath, err)
+	}
+	if time.Since(entry.CreatedAt) > cfg.maxAge {
+		_ = os.Remove(sendingPath)
+		return fmt.Errorf("gave up on spooled %s notification '%s' from %s, which could not be delivered within %s",
+			entry.Channel, entry.SummaryLine, entry.CreatedAt.Format(time.RFC3339), cfg.maxAge)
+	}
+	if !stringSliceContains(deliveryCfg.channels(), entry.Channel) {
+		_ = os.Rename(sendingPath, spoolPath)
+		return nil
+	}
+
+	entryCfg := *deliveryCfg
+	if entryCfg.mail != nil {
+		mailCfg := *entryCfg.mail
+		mailCfg.logFileName = entry.LogFileName
+		entryCfg.mail = &mailCfg
+	}
+	if entryCfg.discord != nil {
+		discordCfg := *entryCfg.discord
+		discordCfg.logFileName = entry.LogFileName
+		entryCfg.discord = &discordCfg
+	}
+	_, err = executeDelivery(&entryCfg, entry.Channel, entry.runOutput())
+	if err != nil {
+		_ = os.Rename(sendingPath, spoolPath)
+		return fmt.Errorf("failed to re-deliver spooled %s notification '%s': %w", entry.Channel, entry.SummaryLine, err)
+	}
+	_ = os.Remove(sendingPath)
+	return nil
+}
+
+// runOutput reconstructs the spooled run's output, noting in its summary line that it is delayed.
+func (e *spoolEntry) runOutput() *runOutput {
+	return &runOutput{
+		output:      e.Output,
+		header:      e.Header,
+		summaryLine: fmt.Sprintf("%s (delayed; first attempted %s)", e.SummaryLine, e.CreatedAt.Format("2006-01-02 15:04:05 -0700")),
+		emoj:        e.Emoj,
+		status:      e.Status,
+		jobName:     e.JobName,
+		hostname:    e.Hostname,
+		exitCode:    e.ExitCode,
+		priority:    e.Priority,
+		startTime:   e.StartTime,
+		endTime:     e.EndTime,
+		succeeded:   e.Succeeded,
+		partial:     e.Partial,
+		traceFile:   e.TraceFile,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	startEmoj     = "▶️"
+	statusStarted = "Started"
+)
+
+// startRunOutput builds the brief output delivered by -notify-on-start, before the program runs.
+func startRunOutput(config *runConfig, startTime time.Time) *runOutput {
+	summaryLine := fmt.Sprintf("[%s] %s running %s", config.outputConfig.hostname, statusStarted, config.outputConfig.label())
+	output := fmt.Sprintf(
+		"%s\n"+
+			"Command: %s\n"+
+			"Start time: %s\n",
+		summaryLine,
+		exec.Command(config.programName, config.programArgs...).String(),
+		startTime.Format("2006-01-02 15:04:05.000 -0700"),
+	)
+	return &runOutput{
+		output:      output,
+		header:      output,
+		summaryLine: summaryLine,
+		emoj:        statusMarker(startEmoj, config.outputConfig.noEmoji),
+		status:      statusStarted,
+		jobName:     config.outputConfig.jobName,
+		hostname:    config.outputConfig.hostname,
+		exitCode:    -1,
+		startTime:   startTime,
+		endTime:     startTime,
+	}
+}
+
+// parseChannelList parses a comma-separated list of delivery channel names.
+func parseChannelList(list string) ([]string, error) {
+	var retv []string
+	for _, channel := range strings.Split(list, ",") {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if channel == "" {
+			continue
+		}
+		if !stringSliceContains(allChannels(), channel) {
+			return nil, fmt.Errorf("unknown channel '%s' (must be one of: %s)", channel, strings.Join(allChannels(), ", "))
+		}
+		retv = append(retv, channel)
+	}
+	return retv, nil
+}
+
+// onlyChannels returns a copy of the delivery config with all channels except the given ones removed.
+func (c *deliveryConfig) onlyChannels(channels []string) *deliveryConfig {
+	retv := &deliveryConfig{transport: c.transport}
+	if stringSliceContains(channels, channelMail) {
+		retv.mail = c.mail
+	}
+	if stringSliceContains(channels, channelNtfy) {
+		retv.ntfy = c.ntfy
+	}
+	if stringSliceContains(channels, channelDiscord) && c.discord != nil {
+		discordCfg := *c.discord
+		retv.discord = &discordCfg
+	}
+	if stringSliceContains(channels, channelZulip) {
+		retv.zulip = c.zulip
+	}
+	if stringSliceContains(channels, channelWhatsApp) {
+		retv.whatsApp = c.whatsApp
+	}
+	if stringSliceContains(channels, channelGotify) {
+		retv.gotify = c.gotify
+	}
+	if stringSliceContains(channels, channelMatrix) {
+		retv.matrix = c.matrix
+	}
+	if stringSliceContains(channels, channelPagerDuty) {
+		retv.pagerduty = c.pagerduty
+	}
+	if stringSliceContains(channels, channelSNS) {
+		retv.sns = c.sns
+	}
+	if stringSliceContains(channels, channelWebhook) {
+		retv.webhook = c.webhook
+	}
+	return retv
+}
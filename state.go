@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// jobState is persisted between runs of a job, as a JSON file in the state directory.
+type jobState struct {
+	// LastDelivered records the last successful delivery time for each delivery channel.
+	LastDelivered map[string]time.Time `json:"last_delivered,omitempty"`
+	// LastStatus is the status of the job's previous run.
+	LastStatus string `json:"last_status,omitempty"`
+	// RecentDurationsMs records the durations of recent successful runs, oldest first.
+	RecentDurationsMs []int64 `json:"recent_durations_ms,omitempty"`
+	// ConsecutiveFailures is the number of failed runs since the job last succeeded.
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+	// LastNotified is the time notifications were last delivered via any channel.
+	LastNotified time.Time `json:"last_notified,omitempty"`
+	// SuppressedNotifications is the number of notifications suppressed by -notify-cooldown
+	// since LastNotified.
+	SuppressedNotifications int `json:"suppressed_notifications,omitempty"`
+}
+
+const (
+	defaultStateDirPerm  = 0750
+	defaultStateFilePerm = 0640
+)
+
+// defaultStateDir returns the directory used for job state when none is configured.
+func defaultStateDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "runner"), nil
+}
+
+func stateFilePath(stateDir, jobName string) string {
+	return filepath.Join(stateDir, removeBadFilenameChars(jobName)+".state.json")
+}
+
+// loadJobState reads the job state at the given path.
+// If no state file exists yet, it returns an empty state.
+func loadJobState(path string) (*jobState, error) {
+	retv := &jobState{}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return retv, nil
+	}
+	if err != nil {
+		return retv, fmt.Errorf("failed to read state file '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(content, retv); err != nil {
+		return &jobState{}, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+	}
+	return retv, nil
+}
+
+// saveJobState atomically writes the job state to the given path, creating its directory if needed.
+func saveJobState(path string, state *jobState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), defaultStateDirPerm); err != nil {
+		return fmt.Errorf("failed to create state directory '%s': %w", filepath.Dir(path), err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	_, err = tmpFile.Write(content)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), defaultStateFilePerm)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return fmt.Errorf("failed to write state file '%s': %w", path, err)
+	}
+	return nil
+}
+
+func (s *jobState) recordDelivery(channel string, at time.Time) {
+	if s.LastDelivered == nil {
+		s.LastDelivered = make(map[string]time.Time)
+	}
+	s.LastDelivered[channel] = at
+}
@@ -0,0 +1,15 @@
+package main
+
+const (
+	defaultSyslogTag      = "runner"
+	defaultSyslogFacility = "user"
+)
+
+// syslogMaxOutputLength limits the output written to syslog for each failed run.
+const syslogMaxOutputLength = 64 * 1024
+
+// syslogConfig, if provided, is assumed to be complete, valid, and internally consistent.
+type syslogConfig struct {
+	tag      string
+	facility string
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// isSyslogFacility returns true if the given name is a syslog facility, e.g. "local0".
+func isSyslogFacility(name string) bool {
+	_, ok := syslogFacilities[name]
+	return ok
+}
+
+// writeSyslog writes the run's summary line, and the output of failed and partially
+// successful runs (one message per line), to the local syslog.
+func writeSyslog(cfg *syslogConfig, runOut *runOutput) error {
+	severity := syslog.LOG_ERR
+	if runOut.partial {
+		severity = syslog.LOG_WARNING
+	} else if runOut.succeeded {
+		severity = syslog.LOG_INFO
+	}
+	w, err := syslog.New(syslogFacilities[cfg.facility]|severity, cfg.tag)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	defer w.Close()
+
+	// the writer logs messages with the severity it was created with:
+	if _, err := w.Write([]byte(runOut.summaryLine)); err != nil {
+		return fmt.Errorf("failed to write to syslog: %w", err)
+	}
+	if runOut.succeeded && !runOut.partial {
+		return nil
+	}
+	// the output begins with the summary line, which was just written:
+	output := strings.TrimPrefix(runOut.output, runOut.summaryLine+"\n")
+	for _, line := range strings.Split(truncateOutputStart(output, syslogMaxOutputLength), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if _, err := w.Write([]byte(line)); err != nil {
+			return fmt.Errorf("failed to write to syslog: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import "errors"
+
+func isSyslogFacility(_ string) bool {
+	return false
+}
+
+func writeSyslog(_ *syslogConfig, _ *runOutput) error {
+	return errors.New("syslog is not supported on Windows")
+}
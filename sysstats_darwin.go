@@ -0,0 +1,6 @@
+package main
+
+func systemStats() string {
+	// not implemented if not on Linux
+	return ""
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemStats returns a brief description of the system's load average and memory usage,
+// or an empty string if they can't be determined.
+func systemStats() string {
+	var parts []string
+	if loadavg, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if fields := strings.Fields(string(loadavg)); len(fields) >= 3 {
+			parts = append(parts, fmt.Sprintf("load %s/%s/%s", fields[0], fields[1], fields[2]))
+		}
+	}
+	if memUsed, ok := memUsedPercent(); ok {
+		parts = append(parts, fmt.Sprintf("mem %.0f%% used", memUsed))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// memUsedPercent returns the percentage of memory which is not available, per /proc/meminfo.
+func memUsedPercent() (float64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	var total, available int64 = -1, -1
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+	if total <= 0 || available < 0 {
+		return 0, false
+	}
+	return float64(total-available) / float64(total) * 100, true
+}
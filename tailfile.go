@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxTailFileBytes limits how much of the end of a -tail-file file is read.
+const maxTailFileBytes = 1024 * 1024
+
+type tailFileSpec struct {
+	path  string
+	lines int
+}
+
+// parseTailFile parses a "PATH:N" -tail-file specification.
+// The path may itself contain colons (e.g. on Windows); the last colon separates the line count.
+func parseTailFile(spec string) (tailFileSpec, error) {
+	idx := strings.LastIndex(spec, ":")
+	if idx < 1 {
+		return tailFileSpec{}, fmt.Errorf("'%s' is not in the form PATH:N", spec)
+	}
+	lines, err := strconv.Atoi(spec[idx+1:])
+	if err != nil || lines < 1 {
+		return tailFileSpec{}, fmt.Errorf("line count in '%s' must be a positive integer", spec)
+	}
+	return tailFileSpec{path: spec[:idx], lines: lines}, nil
+}
+
+// tailFileSection returns an output section containing the last lines of the given file,
+// or a note explaining why they could not be read.
+func tailFileSection(spec tailFileSpec) string {
+	section := strings.Builder{}
+	section.WriteString(fmt.Sprintf("\n--- Tail of %s (last %d lines) ---\n\n", spec.path, spec.lines))
+	content, err := readTail(spec.path, spec.lines)
+	if errors.Is(err, os.ErrNotExist) {
+		section.WriteString("(file does not exist)\n")
+	} else if err != nil {
+		section.WriteString(fmt.Sprintf("(failed to read file: %s)\n", err))
+	} else if content == "" {
+		section.WriteString("(file is empty)\n")
+	} else {
+		section.WriteString(content)
+		if !strings.HasSuffix(content, "\n") {
+			section.WriteRune('\n')
+		}
+	}
+	return section.String()
+}
+
+// readTail returns up to the last n lines of the file at path, reading at most maxTailFileBytes.
+func readTail(path string, n int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - maxTailFileBytes
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if offset > 0 && len(lines) > 0 {
+		// the first line read is likely partial
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, ""), nil
+}
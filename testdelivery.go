@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	testEmoj   = "🧪"
+	statusTest = "Test"
+)
+
+// testRunOutput builds the synthetic output delivered by -test-delivery in place of a program run.
+func testRunOutput(config *runConfig, now time.Time) *runOutput {
+	summaryLine := fmt.Sprintf("Test notification from runner on %s", config.outputConfig.hostname)
+	header := fmt.Sprintf(
+		"%s\n"+
+			"Job name: %s\n"+
+			"Time: %s\n\n",
+		summaryLine,
+		config.outputConfig.jobName,
+		now.Format("2006-01-02 15:04:05.000 -0700"),
+	)
+	if len(config.outputConfig.setupWarnings) > 0 {
+		header += "--- Runner Setup Warnings ---\n\n" + strings.Join(config.outputConfig.setupWarnings, "\n") + "\n\n"
+	}
+	return &runOutput{
+		output:      header + programOutputHeading + "This is a test notification sent by runner -test-delivery. No program was run.\n",
+		header:      header,
+		summaryLine: summaryLine,
+		emoj:        statusMarker(testEmoj, config.outputConfig.noEmoji),
+		status:      statusTest,
+		jobName:     config.outputConfig.jobName,
+		hostname:    config.outputConfig.hostname,
+		exitCode:    -1,
+		startTime:   now,
+		endTime:     now,
+	}
+}
+
+// reportTestDeliveries prints any setup warnings and the result of each -test-delivery
+// delivery, and returns true if all of the deliveries succeeded.
+func reportTestDeliveries(config *runConfig, results []deliveryResult) bool {
+	for _, warning := range config.outputConfig.setupWarnings {
+		fmt.Printf("Setup warning: %s\n", warning)
+	}
+	if len(results) == 0 {
+		fmt.Println("No delivery channels are configured.")
+		return false
+	}
+	ok := true
+	for _, r := range results {
+		if r.err != nil {
+			ok = false
+			fmt.Printf("%s: failed (%s): %s\n", r.channel, r.duration.Round(time.Millisecond), r.err)
+		} else if r.detail != "" {
+			fmt.Printf("%s: ok (%s; %s)\n", r.channel, r.duration.Round(time.Millisecond), r.detail)
+		} else {
+			fmt.Printf("%s: ok (%s)\n", r.channel, r.duration.Round(time.Millisecond))
+		}
+	}
+	return ok
+}
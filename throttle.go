@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseThrottle parses a "CHANNEL=DURATION" throttle specification.
+func parseThrottle(spec string) (string, time.Duration, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("'%s' is not in the form CHANNEL=DURATION", spec)
+	}
+	channel := strings.ToLower(strings.TrimSpace(parts[0]))
+	if !stringSliceContains(allChannels(), channel) {
+		return "", 0, fmt.Errorf("unknown channel '%s' in '%s' (must be one of: %s)",
+			channel, spec, strings.Join(allChannels(), ", "))
+	}
+	interval, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid duration in '%s': %w", spec, err)
+	}
+	if interval <= 0 {
+		return "", 0, fmt.Errorf("duration in '%s' must be positive", spec)
+	}
+	return channel, interval, nil
+}
+
+// throttledChannels returns the channels which delivered within their minimum interval,
+// mapped to the reason each will be skipped.
+func throttledChannels(throttles map[string]time.Duration, state *jobState, now time.Time) map[string]string {
+	retv := make(map[string]string)
+	for channel, interval := range throttles {
+		last, ok := state.LastDelivered[channel]
+		if ok && now.Sub(last) < interval {
+			retv[channel] = fmt.Sprintf("throttled; last delivered at %s, minimum interval is %s",
+				last.Format("2006-01-02 15:04:05 -0700"), interval)
+		}
+	}
+	return retv
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// transportConfig holds network settings shared by all delivery channels.
+// A nil tlsConfig means the system defaults are used.
+// headers (given by -webhook-header) are added to Discord, ntfy, and webhook requests only;
+// see httpClientWithHeaders.
+// A nonzero timeout overrides each delivery channel's default timeout.
+type transportConfig struct {
+	tlsConfig *tls.Config
+	headers   http.Header
+	timeout   time.Duration
+}
+
+// timeoutOr returns the configured delivery timeout, or defaultTimeout if none is configured.
+func (c *transportConfig) timeoutOr(defaultTimeout time.Duration) time.Duration {
+	if c.timeout > 0 {
+		return c.timeout
+	}
+	return defaultTimeout
+}
+
+// httpClient returns a new HTTP client, with the given default timeout, for use by a single delivery.
+func (c *transportConfig) httpClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.tlsConfig != nil {
+		transport.TLSClientConfig = c.tlsConfig.Clone()
+	}
+	return &http.Client{
+		Timeout:   c.timeoutOr(timeout),
+		Transport: transport,
+	}
+}
+
+// httpClientWithHeaders is like httpClient, but the returned client also adds the configured
+// -webhook-header headers to each request. It's only for channels whose endpoints may need
+// them (Discord, ntfy, and webhook), so that those headers are never sent elsewhere.
+func (c *transportConfig) httpClientWithHeaders(timeout time.Duration) *http.Client {
+	client := c.httpClient(timeout)
+	if len(c.headers) > 0 {
+		client.Transport = &headerRoundTripper{headers: c.headers, next: client.Transport}
+	}
+	return client
+}
+
+// headerRoundTripper adds the given headers to each request before passing it to next.
+// Headers the request already sets (e.g. a channel's own Authorization header) are kept.
+type headerRoundTripper struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (t *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		if _, ok := req.Header[name]; ok {
+			continue
+		}
+		req.Header[name] = values
+	}
+	return t.next.RoundTrip(req)
+}
+
+// parseWebhookHeader parses a "NAME=VALUE" header specification.
+// Errors do not include the header's value, which may be a secret.
+func parseWebhookHeader(spec string) (string, string, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	name := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || name == "" {
+		return "", "", fmt.Errorf("header '%s' is not in the form NAME=VALUE", name)
+	}
+	for _, r := range name {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return "", "", fmt.Errorf("header name '%s' contains an invalid character", name)
+		}
+	}
+	if strings.ContainsAny(parts[1], "\r\n") {
+		return "", "", fmt.Errorf("value for header '%s' contains a line break", name)
+	}
+	return http.CanonicalHeaderKey(name), parts[1], nil
+}
+
+// smtpTLSConfig returns the TLS configuration to use when connecting to the given SMTP host,
+// or nil if the mail library's defaults should be used.
+func (c *transportConfig) smtpTLSConfig(host string) *tls.Config {
+	if c.tlsConfig == nil {
+		return nil
+	}
+	retv := c.tlsConfig.Clone()
+	retv.ServerName = host
+	return retv
+}
+
+// loadCACertPool returns the system certificate pool plus the PEM-encoded
+// certificates in each of the given files.
+func loadCACertPool(paths []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, path := range paths {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate file '%s': %w", path, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM-encoded certificates found in '%s'", path)
+		}
+	}
+	return pool, nil
+}